@@ -0,0 +1,160 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"bytes"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// minGetManyPerWorker is the fewest keys GetManyParallel gives a worker,
+// smaller batches use fewer workers
+const minGetManyPerWorker = 256
+
+// GetMany returns the values associated with each of the keys, and whether
+// or not each key exists, in the same order as the keys.  The keys may be
+// in any order, but when they are sorted each lookup resumes from the
+// states shared with the previous key, instead of starting over at the
+// root, which avoids decoding the states of common prefixes repeatedly.
+func (f *FST) GetMany(keys [][]byte) ([]uint64, []bool, error) {
+	err := f.rlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.mu.RUnlock()
+
+	vals := make([]uint64, len(keys))
+	exists := make([]bool, len(keys))
+	var p batchPath
+	for i := range keys {
+		vals[i], exists[i], err = p.get(f, keys[i])
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return vals, exists, nil
+}
+
+// GetManyParallel is like GetMany, but splits the keys between several
+// goroutines, zero workers means the default (GOMAXPROCS).  Each worker
+// sorts its share of the keys first, so that the order of the keys does
+// not matter.
+func (f *FST) GetManyParallel(keys [][]byte, workers int) ([]uint64, []bool, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if max := (len(keys) + minGetManyPerWorker - 1) / minGetManyPerWorker; workers > max {
+		workers = max
+	}
+
+	err := f.rlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.mu.RUnlock()
+
+	vals := make([]uint64, len(keys))
+	exists := make([]bool, len(keys))
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		start := w * len(keys) / workers
+		end := (w + 1) * len(keys) / workers
+		wg.Add(1)
+		go func(w, start, end int) {
+			defer wg.Done()
+			order := make([]int, end-start)
+			for i := range order {
+				order[i] = start + i
+			}
+			sort.Slice(order, func(a, b int) bool {
+				return bytes.Compare(keys[order[a]], keys[order[b]]) < 0
+			})
+			var p batchPath
+			for _, i := range order {
+				vals[i], exists[i], errs[w] = p.get(f, keys[i])
+				if errs[w] != nil {
+					return
+				}
+			}
+		}(w, start, end)
+	}
+	wg.Wait()
+	for _, err = range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return vals, exists, nil
+}
+
+// batchPath remembers the states along the path of the previous key looked
+// up, so that the next lookup can start from the longest common prefix.
+type batchPath struct {
+	prev   []byte
+	states []fstStateV1
+	outs   []uint64 // total output on reaching each state
+
+	// depth is the number of bytes of prev for which states were decoded
+	depth int
+	valid bool
+}
+
+// get looks up the key, the read lock of the FST must be held.
+func (p *batchPath) get(f *FST, key []byte) (uint64, bool, error) {
+	if !p.valid {
+		p.states = append(p.states[:0], fstStateV1{})
+		p.outs = append(p.outs[:0], 0)
+		_, err := f.decoder.stateAt(f.decoder.getRoot(), &p.states[0])
+		if err != nil {
+			return 0, false, err
+		}
+		p.depth = 0
+		p.valid = true
+	}
+
+	// resume from the deepest state shared with the previous key
+	depth := 0
+	for depth < p.depth && depth < len(key) && p.prev[depth] == key[depth] {
+		depth++
+	}
+	p.prev = append(p.prev[:0], key...)
+	p.states = p.states[:depth+1]
+	p.outs = p.outs[:depth+1]
+	p.depth = depth
+
+	for ; depth < len(key); depth++ {
+		_, next, out := p.states[depth].TransitionFor(key[depth])
+		if next == noneAddr {
+			return 0, false, nil
+		}
+		p.states = append(p.states, fstStateV1{})
+		_, err := f.decoder.stateAt(next, &p.states[depth+1])
+		if err != nil {
+			p.valid = false
+			return 0, false, err
+		}
+		p.outs = append(p.outs, p.outs[depth]+out)
+		p.depth = depth + 1
+	}
+
+	state := &p.states[depth]
+	if state.Final() {
+		return p.outs[depth] + state.FinalOutput(), true, nil
+	}
+	return 0, false, nil
+}
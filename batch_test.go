@@ -0,0 +1,151 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// batchTestKeys returns the thousand test words, along with prefixes and
+// extensions of them which are (mostly) not in the FST, and duplicates.
+func batchTestKeys() [][]byte {
+	var keys [][]byte
+	for i, word := range thousandTestWords {
+		keys = append(keys, []byte(word))
+		if i%3 == 0 {
+			keys = append(keys, []byte(word[:len(word)/2]))
+		}
+		if i%5 == 0 {
+			keys = append(keys, []byte(word+"x"))
+		}
+		if i%7 == 0 {
+			keys = append(keys, []byte(word))
+		}
+	}
+	keys = append(keys, []byte{}, []byte{0xff})
+	return keys
+}
+
+func TestGetMany(t *testing.T) {
+	fst, _, cleanup := openTestFST(t)
+	defer cleanup()
+
+	sorted := batchTestKeys()
+	sort.Slice(sorted, func(i, j int) bool {
+		return string(sorted[i]) < string(sorted[j])
+	})
+	shuffled := batchTestKeys()
+	rand.New(rand.NewSource(1)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	tests := []struct {
+		desc string
+		keys [][]byte
+	}{
+		{"sorted", sorted},
+		{"shuffled", shuffled},
+		{"empty", nil},
+	}
+	for _, test := range tests {
+		getters := map[string]func([][]byte) ([]uint64, []bool, error){
+			"GetMany": fst.GetMany,
+			"GetManyParallel": func(keys [][]byte) ([]uint64, []bool, error) {
+				return fst.GetManyParallel(keys, 3)
+			},
+		}
+		for name, getMany := range getters {
+			vals, exists, err := getMany(test.keys)
+			if err != nil {
+				t.Fatalf("%s %s: error: %v", name, test.desc, err)
+			}
+			if len(vals) != len(test.keys) || len(exists) != len(test.keys) {
+				t.Fatalf("%s %s: expected %d results, got %d/%d", name,
+					test.desc, len(test.keys), len(vals), len(exists))
+			}
+			for i, key := range test.keys {
+				val, ok, err := fst.Get(key)
+				if err != nil {
+					t.Fatalf("error getting %q: %v", key, err)
+				}
+				if vals[i] != val || exists[i] != ok {
+					t.Errorf("%s %s: expected %q -> %d %t, got %d %t", name,
+						test.desc, key, val, ok, vals[i], exists[i])
+				}
+			}
+		}
+	}
+
+	err := fst.Close()
+	if err != nil {
+		t.Fatalf("error closing: %v", err)
+	}
+	_, _, err = fst.GetMany(sorted)
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	_, _, err = fst.GetManyParallel(sorted, 0)
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func benchmarkSortedKeys() [][]byte {
+	keys := make([][]byte, len(thousandTestWords))
+	for i, word := range thousandTestWords {
+		keys[i] = []byte(word)
+	}
+	return keys
+}
+
+func BenchmarkGetSorted(b *testing.B) {
+	fst, _, cleanup := openTestFST(b)
+	defer cleanup()
+	keys := benchmarkSortedKeys()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			_, _, _ = fst.Get(key)
+		}
+	}
+}
+
+func BenchmarkGetManySorted(b *testing.B) {
+	fst, _, cleanup := openTestFST(b)
+	defer cleanup()
+	keys := benchmarkSortedKeys()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, _ = fst.GetMany(keys)
+	}
+}
+
+func BenchmarkGetManyParallel(b *testing.B) {
+	fst, _, cleanup := openTestFST(b)
+	defer cleanup()
+	keys := benchmarkSortedKeys()
+	rand.New(rand.NewSource(1)).Shuffle(len(keys), func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, _ = fst.GetManyParallel(keys, 0)
+	}
+}
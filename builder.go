@@ -35,8 +35,14 @@ type Builder struct {
 
 	lastAddr int
 
+	// statistics, see BuilderStats
+	keys     uint64
+	states   uint64
+	maxDepth int
+
 	encoder encoder
 	opts    *BuilderOpts
+	meta    []byte
 
 	builderNodePool *builderNodePool
 }
@@ -53,18 +59,32 @@ func newBuilder(w io.Writer, opts *BuilderOpts) (*Builder, error) {
 	builderNodePool := &builderNodePool{}
 	rv := &Builder{
 		unfinished:      newUnfinishedNodes(builderNodePool),
-		registry:        newRegistry(builderNodePool, opts.RegistryTableSize, opts.RegistryMRUSize),
 		builderNodePool: builderNodePool,
 		opts:            opts,
 		lastAddr:        noneAddr,
 	}
+	if opts.RegistryExact {
+		rv.registry = newExactRegistry(builderNodePool)
+	} else {
+		rv.registry = newRegistry(builderNodePool, opts.RegistryTableSize, opts.RegistryMRUSize)
+	}
+
+	if len(opts.Metadata) > 0 {
+		rv.meta = encodeMetadata(opts.Metadata)
+	}
 
 	var err error
 	rv.encoder, err = loadEncoder(opts.Encoder, w)
 	if err != nil {
 		return nil, err
 	}
-	err = rv.encoder.start()
+	if de, ok := rv.encoder.(denseEncoder); ok {
+		err = de.setDenseThreshold(opts.DenseThreshold)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = rv.encoder.start(rv.meta)
 	if err != nil {
 		return nil, err
 	}
@@ -78,8 +98,11 @@ func (b *Builder) Reset(w io.Writer) error {
 	b.encoder.reset(w)
 	b.last = nil
 	b.len = 0
+	b.keys = 0
+	b.states = 0
+	b.maxDepth = 0
 
-	err := b.encoder.start()
+	err := b.encoder.start(b.meta)
 	if err != nil {
 		return err
 	}
@@ -96,6 +119,7 @@ func (b *Builder) Insert(key []byte, val uint64) error {
 	if len(key) == 0 {
 		b.len = 1
 		b.unfinished.setRootOutput(val)
+		b.inserted()
 		return nil
 	}
 
@@ -107,10 +131,29 @@ func (b *Builder) Insert(key []byte, val uint64) error {
 	}
 	b.copyLastKey(key)
 	b.unfinished.addSuffix(key[prefixLen:], out)
+	b.inserted()
 
 	return nil
 }
 
+// inserted updates the statistics after a key is inserted, and reports
+// progress if configured.
+func (b *Builder) inserted() {
+	b.keys++
+	if len(b.unfinished.stack) > b.maxDepth {
+		b.maxDepth = len(b.unfinished.stack)
+	}
+	if b.opts.Progress != nil {
+		interval := b.opts.ProgressInterval
+		if interval <= 0 {
+			interval = defaultProgressInterval
+		}
+		if b.keys%uint64(interval) == 0 {
+			b.opts.Progress(b.Stats())
+		}
+	}
+}
+
 func (b *Builder) copyLastKey(key []byte) {
 	if b.last == nil {
 		b.last = make([]byte, 0, 64)
@@ -120,6 +163,45 @@ func (b *Builder) copyLastKey(key []byte) {
 	b.last = append(b.last, key...)
 }
 
+const defaultProgressInterval = 100000
+
+// BuilderStats describes the work done by a Builder so far.
+type BuilderStats struct {
+	// Keys is the number of keys inserted.
+	Keys uint64
+
+	// States is the number of states written.
+	States uint64
+
+	// Bytes is the number of bytes written (some may still be buffered).
+	Bytes uint64
+
+	// RegistryHits is the number of states found to be equivalent to a
+	// state already written, which are shared instead of written again.
+	RegistryHits uint64
+
+	// RegistryMisses is the number of states looked up in the registry
+	// which were not found, and so are written.
+	RegistryMisses uint64
+
+	// MaxDepth is the largest number of unfinished states, which is one
+	// more than the length of the longest key inserted.
+	MaxDepth int
+}
+
+// Stats returns statistics describing the work done by this Builder since
+// it was created or last Reset.
+func (b *Builder) Stats() BuilderStats {
+	return BuilderStats{
+		Keys:           b.keys,
+		States:         b.states,
+		Bytes:          uint64(b.encoder.written()),
+		RegistryHits:   b.registry.hits,
+		RegistryMisses: b.registry.misses,
+		MaxDepth:       b.maxDepth,
+	}
+}
+
 // Close MUST be called after inserting all values.
 func (b *Builder) Close() error {
 	err := b.compileFrom(0)
@@ -166,9 +248,12 @@ func (b *Builder) compile(node *builderNode) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	b.states++
 
 	b.lastAddr = addr
-	entry.addr = addr
+	if entry != nil {
+		entry.addr = addr
+	}
 	return addr, nil
 }
 
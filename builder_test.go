@@ -16,6 +16,7 @@ package vellum
 
 import (
 	"bufio"
+	"bytes"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -254,3 +255,103 @@ func BenchmarkBuilder(b *testing.B) {
 		}
 	}
 }
+
+func TestBuilderStats(t *testing.T) {
+	var buf bytes.Buffer
+	b, err := New(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"", "bat", "cat", "category"}
+	for _, key := range keys {
+		err = b.Insert([]byte(key), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := b.Stats()
+	if stats.Keys != uint64(len(keys)) {
+		t.Errorf("expected %d keys, got %d", len(keys), stats.Keys)
+	}
+	if stats.MaxDepth != len("category")+1 {
+		t.Errorf("expected max depth %d, got %d", len("category")+1, stats.MaxDepth)
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats = b.Stats()
+	if stats.Bytes != uint64(buf.Len()) {
+		t.Errorf("expected %d bytes, got %d", buf.Len(), stats.Bytes)
+	}
+	if stats.States != stats.RegistryMisses {
+		t.Errorf("expected a state written for each registry miss, got %+v", stats)
+	}
+
+	// count the distinct states reachable in the fst, excluding the
+	// final state which is never written
+	fst, err := Load(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[int]bool{}
+	stack := []int{fst.decoder.getRoot()}
+	for len(stack) > 0 {
+		addr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if addr == emptyAddr || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		state, err := fst.decoder.stateAt(addr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < state.NumTransitions(); i++ {
+			_, dest, _ := state.TransitionFor(state.TransitionAt(i))
+			stack = append(stack, dest)
+		}
+	}
+	if stats.States != uint64(len(seen)) {
+		t.Errorf("expected %d states, got %d", len(seen), stats.States)
+	}
+}
+
+func TestBuilderProgress(t *testing.T) {
+	var calls []BuilderStats
+	b, err := New(ioutil.Discard, &BuilderOpts{
+		Encoder:           1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+		Progress: func(stats BuilderStats) {
+			calls = append(calls, stats)
+		},
+		ProgressInterval: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := append([]string(nil), thousandTestWords...)
+	sort.Strings(keys)
+	for _, key := range keys {
+		err = b.Insert([]byte(key), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != len(keys)/100 {
+		t.Fatalf("expected %d progress calls, got %d", len(keys)/100, len(calls))
+	}
+	for i, stats := range calls {
+		if stats.Keys != uint64(100*(i+1)) {
+			t.Errorf("expected progress call %d at %d keys, got %d", i, 100*(i+1), stats.Keys)
+		}
+		if i > 0 && stats.Bytes < calls[i-1].Bytes {
+			t.Errorf("expected bytes to grow, got %d after %d", stats.Bytes, calls[i-1].Bytes)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"hash/crc32"
+	"io"
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksumWriter computes the CRC32C of everything written through it.
+// It sits beneath the buffered writer, so the checksum is updated a
+// buffer at a time instead of a byte at a time.
+type checksumWriter struct {
+	w   io.Writer
+	crc uint32
+}
+
+func newChecksumWriter(w io.Writer) *checksumWriter {
+	return &checksumWriter{
+		w: w,
+	}
+}
+
+func (c *checksumWriter) Reset(w io.Writer) {
+	c.w = w
+	c.crc = 0
+}
+
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.crc = crc32.Update(c.crc, castagnoliTable, p[:n])
+	return n, err
+}
+
+// checksumDecoder is implemented by decoders for versions which store a
+// checksum of the data.
+type checksumDecoder interface {
+	// checksum returns the stored checksum, the checksum computed over
+	// the data and the offset where the stored checksum is found.
+	checksum() (stored uint32, computed uint32, offset int)
+}
+
+// maskChecksum returns the masked form of a checksum used by the
+// BurntSushi/fst format, the mask is the same as used by snappy.
+func maskChecksum(crc uint32) uint32 {
+	return ((crc >> 15) | (crc << 17)) + 0xa282ead8
+}
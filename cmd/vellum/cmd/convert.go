@@ -0,0 +1,120 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/couchbase/vellum"
+	"github.com/spf13/cobra"
+)
+
+var toVersion int
+var dropMetadata bool
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Converts a vellum FST file to another encoding version",
+	Long: `Converts a vellum FST file to another encoding version.  The keys, ` +
+		`values and metadata are copied to the target file, and the change in ` +
+		`size is reported.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("source and target paths are required")
+		}
+		if len(args) < 2 {
+			return fmt.Errorf("target path is required")
+		}
+		if toVersion < 1 {
+			return fmt.Errorf("--to-version is required")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		srcInfo, err := os.Stat(args[0])
+		if err != nil {
+			return err
+		}
+		fst, err := vellum.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer fst.Close()
+
+		// the source remains mapped while the target is written, so the
+		// target is written to a temporary file, renamed once complete,
+		// which also allows converting a file in place
+		f, err := ioutil.TempFile(filepath.Dir(args[1]), filepath.Base(args[1])+".tmp")
+		if err != nil {
+			return err
+		}
+		// the temporary file is only accessible by its owner, the target
+		// keeps its permissions if it exists, otherwise takes those of
+		// the source
+		mode := srcInfo.Mode().Perm()
+		if dstInfo, serr := os.Stat(args[1]); serr == nil {
+			mode = dstInfo.Mode().Perm()
+		}
+		err = f.Chmod(mode)
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+			return err
+		}
+
+		opts := &vellum.BuilderOpts{
+			Encoder:           toVersion,
+			RegistryTableSize: 10000,
+			RegistryMRUSize:   2,
+		}
+		if dropMetadata {
+			opts.Metadata = map[string][]byte{}
+		}
+		err = vellum.Transcode(fst, f, opts)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), args[1])
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+			return err
+		}
+
+		dstInfo, err := os.Stat(args[1])
+		if err != nil {
+			return err
+		}
+		delta := dstInfo.Size() - srcInfo.Size()
+		fmt.Printf("%s: version %d, %d bytes\n", args[0], fst.Version(), srcInfo.Size())
+		fmt.Printf("%s: version %d, %d bytes\n", args[1], toVersion, dstInfo.Size())
+		if srcInfo.Size() > 0 {
+			fmt.Printf("size change: %+d bytes (%+.1f%%)\n", delta,
+				100*float64(delta)/float64(srcInfo.Size()))
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(convertCmd)
+	convertCmd.Flags().IntVar(&toVersion, "to-version", 0, "target encoding version")
+	convertCmd.Flags().BoolVar(&dropMetadata, "drop-metadata", false,
+		"do not copy the metadata (required for versions without metadata)")
+}
@@ -16,6 +16,7 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/couchbase/vellum"
 	"github.com/spf13/cobra"
@@ -38,6 +39,18 @@ var infoCmd = &cobra.Command{
 		}
 		fmt.Printf("version: %d\n", fst.Version())
 		fmt.Printf("length: %d\n", fst.Len())
+		meta := fst.Metadata()
+		if len(meta) > 0 {
+			keys := make([]string, 0, len(meta))
+			for k := range meta {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			fmt.Printf("metadata:\n")
+			for _, k := range keys {
+				fmt.Printf("  %s: %q\n", k, meta[k])
+			}
+		}
 		return nil
 	},
 }
@@ -0,0 +1,75 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/couchbase/vellum"
+	"github.com/spf13/cobra"
+)
+
+var scanAll bool
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Scan finds the keys of this vellum FST file occurring in text read from stdin",
+	Long: `Scan finds the keys of this vellum FST file occurring in text read from
+stdin.  Each match is printed as the start and end byte offsets, the key and
+its value.  By default the text is segmented leftmost-longest, so matches do
+not overlap, use --all to print every occurrence of every key.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("path is required")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fst, err := vellum.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = fst.Close()
+		}()
+		text, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		mode := vellum.ScanLongest
+		if scanAll {
+			mode = vellum.ScanAll
+		}
+		w := bufio.NewWriter(os.Stdout)
+		err = vellum.NewScanner(fst, mode).Scan(text, func(m vellum.ScanMatch) error {
+			_, err := fmt.Fprintf(w, "%d %d %q %d\n", m.Start, m.End,
+				text[m.Start:m.End], m.Val)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(scanCmd)
+	scanCmd.Flags().BoolVar(&scanAll, "all", false,
+		"print every occurrence of every key, including overlapping ones")
+}
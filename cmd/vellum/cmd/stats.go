@@ -0,0 +1,99 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/couchbase/vellum"
+	"github.com/spf13/cobra"
+)
+
+var statsJSON bool
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Prints statistics about the structure of this vellum FST file",
+	Long: `Prints statistics about the structure of this vellum FST file, the number
+of states and transitions, how they are encoded, the distribution of
+fan-out, depth and key length, and the size of each section of the file.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("path is required")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fst, err := vellum.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = fst.Close()
+		}()
+		stats, err := fst.Stats()
+		if err != nil {
+			return err
+		}
+		if statsJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(stats)
+		}
+		printStats(stats)
+		return nil
+	},
+}
+
+func printStats(stats *vellum.FSTStats) {
+	fmt.Printf("version: %d\n", stats.Version)
+	fmt.Printf("keys: %d\n", stats.Keys)
+	fmt.Printf("states: %d\n", stats.States)
+	fmt.Printf("  final: %d\n", stats.FinalStates)
+	fmt.Printf("  single transition encoding: %d\n", stats.SingleTransStates)
+	fmt.Printf("  multiple transition encoding: %d\n", stats.MultiTransStates)
+	fmt.Printf("transitions: %d\n", stats.Transitions)
+	fmt.Printf("key length: avg %.2f, max %d\n", stats.AvgKeyLen, stats.MaxKeyLen)
+	fmt.Printf("bytes: %d\n", stats.Bytes.Total)
+	fmt.Printf("  header: %d\n", stats.Bytes.Header)
+	fmt.Printf("  metadata: %d\n", stats.Bytes.Metadata)
+	fmt.Printf("  states: %d\n", stats.Bytes.States)
+	fmt.Printf("    single transition encoding: %d\n", stats.Bytes.SingleTransStates)
+	fmt.Printf("    multiple transition encoding: %d\n", stats.Bytes.MultiTransStates)
+	fmt.Printf("  footer: %d\n", stats.Bytes.Footer)
+	printHistogram("fan-out", stats.FanOut)
+	printHistogram("depth", stats.Depths)
+	printHistogram("key length", stats.KeyLengths)
+}
+
+func printHistogram(name string, hist map[int]int) {
+	keys := make([]int, 0, len(hist))
+	for k := range hist {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	fmt.Printf("%s:\n", name)
+	for _, k := range keys {
+		fmt.Printf("  %d: %d\n", k, hist[k])
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(statsCmd)
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "print the statistics as JSON")
+}
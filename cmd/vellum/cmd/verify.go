@@ -0,0 +1,69 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/couchbase/vellum"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verifies the integrity of these vellum FST files",
+	Long: `Verifies the integrity of these vellum FST files.  The checksum is ` +
+		`validated (if the version stores one), and every state is decoded and ` +
+		`checked.  Any corruption is reported with its byte offset.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("path is required")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var failed int
+		for _, path := range args {
+			err := verifyPath(path)
+			if err != nil {
+				fmt.Printf("%s: %v\n", path, err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s: ok\n", path)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d files failed verification", failed, len(args))
+		}
+		return nil
+	},
+}
+
+func verifyPath(path string) error {
+	fst, err := vellum.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fst.Close()
+	if !fst.HasChecksum() {
+		fmt.Printf("%s: version %d has no checksum, verifying structure only\n",
+			path, fst.Version())
+	}
+	return fst.Verify()
+}
+
+func init() {
+	RootCmd.AddCommand(verifyCmd)
+}
@@ -0,0 +1,335 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const containerMagic = "vellumct"
+const containerVersion = 1
+const containerHeaderSize = 16
+const containerFooterSize = 16
+
+// ContainerWriter writes several named FSTs, along with user metadata,
+// into a single file.  The FST data is streamed out as it is written,
+// the table of contents is written by Close().
+type ContainerWriter struct {
+	bw      *writer
+	entries []containerEntry
+	names   map[string]struct{}
+	meta    map[string][]byte
+	curr    *containerEntry
+	closed  bool
+}
+
+type containerEntry struct {
+	name   string
+	offset int
+	length int
+}
+
+// NewContainerWriter returns a new ContainerWriter which will stream out
+// the container to the provided Writer.
+func NewContainerWriter(w io.Writer) (*ContainerWriter, error) {
+	rv := &ContainerWriter{
+		bw:    newWriter(w),
+		names: map[string]struct{}{},
+		meta:  map[string][]byte{},
+	}
+	header := make([]byte, containerHeaderSize)
+	copy(header, containerMagic)
+	binary.LittleEndian.PutUint64(header[8:], containerVersion)
+	_, err := rv.bw.Write(header)
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// Create adds a new FST with the provided name to the container, and returns
+// a Writer to which the FST data should be written, typically by passing it
+// to New().  The FST data MUST be completely written (the Builder closed)
+// before calling Create() again or calling Close().
+func (c *ContainerWriter) Create(name string) (io.Writer, error) {
+	if c.closed {
+		return nil, fmt.Errorf("container writer closed")
+	}
+	if _, exists := c.names[name]; exists {
+		return nil, fmt.Errorf("duplicate fst name '%s' in container", name)
+	}
+	c.finishCurrent()
+	c.names[name] = struct{}{}
+	c.entries = append(c.entries, containerEntry{
+		name:   name,
+		offset: c.bw.counter,
+	})
+	c.curr = &c.entries[len(c.entries)-1]
+	return c.bw, nil
+}
+
+// SetMetadata associates the provided value with the key in the container
+// metadata, replacing any previous value.
+func (c *ContainerWriter) SetMetadata(key string, val []byte) {
+	c.meta[key] = append([]byte(nil), val...)
+}
+
+func (c *ContainerWriter) finishCurrent() {
+	if c.curr != nil {
+		c.curr.length = c.bw.counter - c.curr.offset
+		c.curr = nil
+	}
+}
+
+// Close MUST be called after all FSTs have been written, it writes out the
+// table of contents and flushes all remaining data to the underlying Writer.
+func (c *ContainerWriter) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.finishCurrent()
+	c.closed = true
+
+	tocOffset := c.bw.counter
+	var buf [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) error {
+		n := binary.PutUvarint(buf[:], v)
+		_, err := c.bw.Write(buf[:n])
+		return err
+	}
+	putBytes := func(b []byte) error {
+		err := putUvarint(uint64(len(b)))
+		if err != nil {
+			return err
+		}
+		_, err = c.bw.Write(b)
+		return err
+	}
+
+	err := putUvarint(uint64(len(c.entries)))
+	if err != nil {
+		return err
+	}
+	for _, entry := range c.entries {
+		err = putBytes([]byte(entry.name))
+		if err != nil {
+			return err
+		}
+		err = putUvarint(uint64(entry.offset))
+		if err != nil {
+			return err
+		}
+		err = putUvarint(uint64(entry.length))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = c.bw.Write(encodeMetadata(c.meta))
+	if err != nil {
+		return err
+	}
+
+	footer := make([]byte, containerFooterSize)
+	binary.LittleEndian.PutUint64(footer, uint64(tocOffset))
+	copy(footer[8:], containerMagic)
+	_, err = c.bw.Write(footer)
+	if err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+// Container is a read-only view of a file containing several named FSTs
+// and user metadata.  The FSTs returned by a Container share its
+// underlying data, they remain valid only until the Container is closed.
+type Container struct {
+	f       io.Closer
+	data    []byte
+	entries []containerEntry
+	meta    map[string][]byte
+}
+
+// OpenContainer loads the container stored in the provided path.  Like
+// Open(), mmap is used by default and the file is only mapped once for all
+// of the FSTs it contains.
+func OpenContainer(path string) (*Container, error) {
+	data, closer, err := openData(path)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := newContainer(data, closer)
+	if err != nil {
+		if closer != nil {
+			_ = closer.Close()
+		}
+		return nil, err
+	}
+	return rv, nil
+}
+
+// LoadContainer will return the Container represented by the provided
+// byte slice.
+func LoadContainer(data []byte) (*Container, error) {
+	return newContainer(data, nil)
+}
+
+func newContainer(data []byte, f io.Closer) (*Container, error) {
+	if len(data) < containerHeaderSize+containerFooterSize {
+		return nil, truncatedError(len(data), fmt.Sprintf("invalid container < %d bytes",
+			containerHeaderSize+containerFooterSize))
+	}
+	if string(data[:8]) != containerMagic {
+		return nil, corruptError(0, "invalid container header")
+	}
+	ver := binary.LittleEndian.Uint64(data[8:16])
+	if ver != containerVersion {
+		return nil, &UnsupportedVersionError{Version: int(ver), what: "container decoder"}
+	}
+	footer := data[len(data)-containerFooterSize:]
+	if string(footer[8:]) != containerMagic {
+		// the header was valid, so the most likely cause of a missing
+		// footer is a partially written file
+		return nil, truncatedError(len(data), "invalid container footer")
+	}
+	tocEnd := len(data) - containerFooterSize
+	tocOffset := binary.LittleEndian.Uint64(footer)
+	if tocOffset < containerHeaderSize || tocOffset > uint64(tocEnd) {
+		return nil, corruptError(len(data)-containerFooterSize,
+			fmt.Sprintf("invalid container toc offset %d", tocOffset))
+	}
+
+	rv := &Container{
+		f:    f,
+		data: data,
+	}
+
+	toc := data[tocOffset:tocEnd]
+	tocPos := int(tocOffset)
+	var err error
+	readUvarint := func() uint64 {
+		if err != nil {
+			return 0
+		}
+		v, n := binary.Uvarint(toc)
+		if n <= 0 {
+			err = corruptError(tocPos, "invalid container toc")
+			return 0
+		}
+		toc = toc[n:]
+		tocPos += n
+		return v
+	}
+	readBytes := func() []byte {
+		l := readUvarint()
+		if err != nil {
+			return nil
+		}
+		if l > uint64(len(toc)) {
+			err = corruptError(tocPos, "invalid container toc")
+			return nil
+		}
+		rv := toc[:l]
+		toc = toc[l:]
+		tocPos += int(l)
+		return rv
+	}
+
+	numEntries := readUvarint()
+	for i := uint64(0); i < numEntries && err == nil; i++ {
+		name := readBytes()
+		offset := readUvarint()
+		length := readUvarint()
+		if err != nil {
+			break
+		}
+		if offset < containerHeaderSize || offset > tocOffset ||
+			length > tocOffset-offset {
+			return nil, corruptError(tocPos, fmt.Sprintf(
+				"invalid container entry '%s' %d/%d", name, offset, length))
+		}
+		rv.entries = append(rv.entries, containerEntry{
+			name:   string(name),
+			offset: int(offset),
+			length: int(length),
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	rv.meta, err = decodeMetadata(toc, tocPos)
+	if err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+// Names returns the names of the FSTs in this container, in the order they
+// were written.
+func (c *Container) Names() []string {
+	rv := make([]string, 0, len(c.entries))
+	for _, entry := range c.entries {
+		rv = append(rv, entry.name)
+	}
+	return rv
+}
+
+// FST returns the FST stored in this container with the provided name.
+// The FST shares the data of the Container, calling Close() on it is
+// allowed but does not release anything, the Container must be closed.
+func (c *Container) FST(name string) (*FST, error) {
+	for _, entry := range c.entries {
+		if entry.name == name {
+			return new(c.data[entry.offset:entry.offset+entry.length], nil, nil)
+		}
+	}
+	return nil, fmt.Errorf("no fst named '%s' in container", name)
+}
+
+// Metadata returns the value associated with the provided key in the
+// container metadata, and whether or not the key exists.
+func (c *Container) Metadata(key string) ([]byte, bool) {
+	v, ok := c.meta[key]
+	return v, ok
+}
+
+// MetadataKeys returns the keys of the container metadata in sorted order.
+func (c *Container) MetadataKeys() []string {
+	rv := make([]string, 0, len(c.meta))
+	for k := range c.meta {
+		rv = append(rv, k)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// Close will unmap any mmap'd data (if managed by vellum) and it will close
+// the backing file (if managed by vellum).  FSTs obtained from this
+// Container MUST NOT be used after calling Close().
+func (c *Container) Close() error {
+	if c.f != nil {
+		err := c.f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	c.data = nil
+	c.entries = nil
+	return nil
+}
@@ -0,0 +1,184 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func buildContainer(t *testing.T, c *ContainerWriter, sets map[string]map[string]uint64, names []string) {
+	for _, name := range names {
+		w, err := c.Create(name)
+		if err != nil {
+			t.Fatalf("error creating fst %s: %v", name, err)
+		}
+		b, err := New(w, nil)
+		if err != nil {
+			t.Fatalf("error creating builder: %v", err)
+		}
+		err = insertStringMap(b, sets[name])
+		if err != nil {
+			t.Fatalf("error building: %v", err)
+		}
+		err = b.Close()
+		if err != nil {
+			t.Fatalf("error closing: %v", err)
+		}
+	}
+}
+
+func TestContainerRoundTrip(t *testing.T) {
+	f, err := ioutil.TempFile("", "vellum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Remove(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	sets := map[string]map[string]uint64{
+		"days":  smallSample,
+		"pets":  {"cat": 1, "dog": 2, "fish": 3},
+		"empty": {},
+	}
+	names := []string{"pets", "days", "empty"}
+
+	c, err := NewContainerWriter(f)
+	if err != nil {
+		t.Fatalf("error creating container writer: %v", err)
+	}
+	buildContainer(t, c, sets, names)
+	c.SetMetadata("creator", []byte("test"))
+	c.SetMetadata("segment", []byte{0, 1, 2})
+	_, err = c.Create("days")
+	if err == nil {
+		t.Errorf("expected error creating duplicate name, got nil")
+	}
+	err = c.Close()
+	if err != nil {
+		t.Fatalf("error closing container writer: %v", err)
+	}
+
+	container, err := OpenContainer(f.Name())
+	if err != nil {
+		t.Fatalf("error opening container: %v", err)
+	}
+	defer func() {
+		err = container.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if !reflect.DeepEqual(names, container.Names()) {
+		t.Errorf("expected names %v, got %v", names, container.Names())
+	}
+
+	for _, name := range names {
+		fst, err := container.FST(name)
+		if err != nil {
+			t.Fatalf("error loading fst %s: %v", name, err)
+		}
+		got := map[string]uint64{}
+		itr, err := fst.Iterator(nil, nil)
+		for err == nil {
+			key, val := itr.Current()
+			got[string(key)] = val
+			err = itr.Next()
+		}
+		if err != ErrIteratorDone {
+			t.Errorf("iterator error: %v", err)
+		}
+		if !reflect.DeepEqual(sets[name], got) {
+			t.Errorf("expected %v, got: %v", sets[name], got)
+		}
+		if fst.Len() != len(sets[name]) {
+			t.Errorf("expected len %d, got %d", len(sets[name]), fst.Len())
+		}
+	}
+
+	_, err = container.FST("missing")
+	if err == nil {
+		t.Errorf("expected error loading missing fst, got nil")
+	}
+
+	v, ok := container.Metadata("creator")
+	if !ok || string(v) != "test" {
+		t.Errorf("expected metadata creator 'test', got '%s' %t", v, ok)
+	}
+	v, ok = container.Metadata("segment")
+	if !ok || !bytes.Equal(v, []byte{0, 1, 2}) {
+		t.Errorf("expected metadata segment [0 1 2], got %v %t", v, ok)
+	}
+	_, ok = container.Metadata("missing")
+	if ok {
+		t.Errorf("expected metadata missing to not exist")
+	}
+	keys := container.MetadataKeys()
+	if !reflect.DeepEqual(keys, []string{"creator", "segment"}) {
+		t.Errorf("expected metadata keys [creator segment], got %v", keys)
+	}
+}
+
+func TestContainerLoadInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := NewContainerWriter(&buf)
+	if err != nil {
+		t.Fatalf("error creating container writer: %v", err)
+	}
+	buildContainer(t, c, map[string]map[string]uint64{"a": smallSample}, []string{"a"})
+	err = c.Close()
+	if err != nil {
+		t.Fatalf("error closing container writer: %v", err)
+	}
+	data := buf.Bytes()
+
+	_, err = LoadContainer(data)
+	if err != nil {
+		t.Fatalf("unexpected error loading container: %v", err)
+	}
+
+	tests := []struct {
+		desc string
+		data []byte
+	}{
+		{"short", data[:containerHeaderSize]},
+		{"bad header", append([]byte("notvellum"), data[9:]...)},
+		{"truncated", data[:len(data)-1]},
+		{"toc offset past end", func() []byte {
+			rv := append([]byte(nil), data...)
+			rv[len(rv)-containerFooterSize] = 0xff
+			rv[len(rv)-containerFooterSize+1] = 0xff
+			return rv
+		}()},
+	}
+	for _, test := range tests {
+		_, err = LoadContainer(test.data)
+		if err == nil {
+			t.Errorf("%s: expected error loading container, got nil", test.desc)
+		}
+	}
+}
@@ -22,39 +22,59 @@ import (
 )
 
 func init() {
-	registerDecoder(versionV1, func(data []byte) decoder {
-		return newDecoderV1(data)
+	registerDecoder(versionV1, func(data []byte, safe bool) decoder {
+		d := newDecoderV1(data)
+		d.safe = safe
+		return d
 	})
 }
 
 type decoderV1 struct {
-	data []byte
+	data       []byte
+	footerSize int
+	safe       bool
+
+	// transIndexThreshold is non-zero for versions where states with more
+	// than this number of transitions also store a transition index
+	transIndexThreshold int
+
+	// denseThreshold is non-zero for versions where states with at least
+	// this number of transitions also store a transition bitmap
+	denseThreshold int
 }
 
 func newDecoderV1(data []byte) *decoderV1 {
 	return &decoderV1{
-		data: data,
+		data:       data,
+		footerSize: footerSizeV1,
 	}
 }
 
 func (d *decoderV1) getRoot() int {
-	if len(d.data) < footerSizeV1 {
+	if len(d.data) < d.footerSize {
 		return noneAddr
 	}
-	footer := d.data[len(d.data)-footerSizeV1:]
+	footer := d.data[len(d.data)-d.footerSize:]
 	root := binary.LittleEndian.Uint64(footer[8:])
 	return int(root)
 }
 
 func (d *decoderV1) getLen() int {
-	if len(d.data) < footerSizeV1 {
+	if len(d.data) < d.footerSize {
 		return 0
 	}
-	footer := d.data[len(d.data)-footerSizeV1:]
+	footer := d.data[len(d.data)-d.footerSize:]
 	dlen := binary.LittleEndian.Uint64(footer)
 	return int(dlen)
 }
 
+func (d *decoderV1) getFooterOffset() int {
+	if len(d.data) < d.footerSize {
+		return 0
+	}
+	return len(d.data) - d.footerSize
+}
+
 func (d *decoderV1) stateAt(addr int, prealloc fstState) (fstState, error) {
 	state, ok := prealloc.(*fstStateV1)
 	if ok && state != nil {
@@ -62,7 +82,9 @@ func (d *decoderV1) stateAt(addr int, prealloc fstState) (fstState, error) {
 	} else {
 		state = &fstStateV1{}
 	}
-	err := state.at(d.data, addr)
+	state.transIndexThreshold = d.transIndexThreshold
+	state.denseThreshold = d.denseThreshold
+	err := state.at(d.data, addr, d.safe)
 	if err != nil {
 		return nil, err
 	}
@@ -74,6 +96,7 @@ type fstStateV1 struct {
 	top      int
 	bottom   int
 	numTrans int
+	safe     bool
 
 	// single trans only
 	singleTransChar byte
@@ -94,6 +117,16 @@ type fstStateV1 struct {
 	outTop      int
 	outBottom   int
 	outFinal    int
+
+	// transition index, only used by versions which set the threshold
+	transIndexThreshold int
+	indexed             bool
+	indexBottom         int
+
+	// transition bitmap, only used by versions which set the threshold
+	denseThreshold int
+	dense          bool
+	bitmapBottom   int
 }
 
 func (f *fstStateV1) isEncodedSingle() bool {
@@ -103,22 +136,26 @@ func (f *fstStateV1) isEncodedSingle() bool {
 	return false
 }
 
-func (f *fstStateV1) at(data []byte, addr int) error {
+// at decodes the state at the provided address.  When safe is true every
+// offset is checked against the bounds of the data before it is read, and
+// a *CorruptError is returned instead of panicking.
+func (f *fstStateV1) at(data []byte, addr int, safe bool) error {
 	f.data = data
+	f.safe = safe
 	if addr == emptyAddr {
 		return f.atZero()
 	} else if addr == noneAddr {
 		return f.atNone()
 	}
-	if addr > len(data) || addr < 16 {
-		return fmt.Errorf("invalid address %d/%d", addr, len(data))
+	if addr >= len(data) || addr < 16 {
+		return corruptError(addr, fmt.Sprintf("invalid address %d/%d", addr, len(data)))
 	}
 	f.top = addr
 	f.bottom = addr
 	if f.isEncodedSingle() {
-		return f.atSingle(data, addr)
+		return f.atSingle(data, addr, safe)
 	}
-	return f.atMulti(data, addr)
+	return f.atMulti(data, addr, safe)
 }
 
 func (f *fstStateV1) atZero() error {
@@ -139,7 +176,21 @@ func (f *fstStateV1) atNone() error {
 	return nil
 }
 
-func (f *fstStateV1) atSingle(data []byte, addr int) error {
+// checkBottom returns an error if the bottom of the state being decoded
+// has moved before the start of the data, or if the pack sizes decoded
+// are larger than any valid packed uint64
+func (f *fstStateV1) checkBottom() error {
+	if f.bottom < 0 {
+		return corruptError(f.top, "state extends before start of data")
+	}
+	if f.transSize > 8 || f.outSize > 8 {
+		return corruptError(f.top, fmt.Sprintf("invalid pack sizes %d/%d",
+			f.transSize, f.outSize))
+	}
+	return nil
+}
+
+func (f *fstStateV1) atSingle(data []byte, addr int, safe bool) error {
 	// handle single transition case
 	f.numTrans = 1
 	f.singleTransNext = data[f.top]&transitionNext > 0
@@ -158,9 +209,19 @@ func (f *fstStateV1) atSingle(data []byte, addr int) error {
 		f.bottom-- // extra byte with pack sizes
 		f.transSize, f.outSize = decodePackSize(data[f.bottom])
 		f.bottom -= f.transSize // exactly one trans
+		if safe {
+			if err := f.checkBottom(); err != nil {
+				return err
+			}
+		}
 		f.singleTransAddr = readPackedUint(data[f.bottom : f.bottom+f.transSize])
 		if f.outSize > 0 {
 			f.bottom -= f.outSize // exactly one out (could be length 0 though)
+			if safe {
+				if err := f.checkBottom(); err != nil {
+					return err
+				}
+			}
 			f.singleTransOut = readPackedUint(data[f.bottom : f.bottom+f.outSize])
 		} else {
 			f.singleTransOut = 0
@@ -173,7 +234,7 @@ func (f *fstStateV1) atSingle(data []byte, addr int) error {
 	return nil
 }
 
-func (f *fstStateV1) atMulti(data []byte, addr int) error {
+func (f *fstStateV1) atMulti(data []byte, addr int, safe bool) error {
 	// handle multiple transitions case
 	f.final = data[f.top]&stateFinal > 0
 	f.numTrans = int(data[f.top] & maxNumTrans)
@@ -188,6 +249,18 @@ func (f *fstStateV1) atMulti(data []byte, addr int) error {
 	f.bottom-- // extra byte with pack sizes
 	f.transSize, f.outSize = decodePackSize(data[f.bottom])
 
+	if f.transIndexThreshold > 0 && f.numTrans > f.transIndexThreshold {
+		// index of 256 bytes, from input byte to transition number
+		f.indexed = true
+		f.bottom -= transIndexSize
+		f.indexBottom = f.bottom
+	} else if f.denseThreshold > 0 && f.numTrans >= f.denseThreshold {
+		// bitmap of 256 bits, one for each input byte with a transition
+		f.dense = true
+		f.bottom -= transBitmapSize
+		f.bitmapBottom = f.bottom
+	}
+
 	f.transTop = f.bottom
 	f.bottom -= f.numTrans // one byte for each transition
 	f.transBottom = f.bottom
@@ -205,6 +278,11 @@ func (f *fstStateV1) atMulti(data []byte, addr int) error {
 			f.outFinal = f.bottom
 		}
 	}
+	if safe {
+		// all sections of this state lie between bottom and top, so
+		// checking the bottom is sufficient
+		return f.checkBottom()
+	}
 	return nil
 }
 
@@ -238,14 +316,33 @@ func (f *fstStateV1) TransitionAt(i int) byte {
 func (f *fstStateV1) TransitionFor(b byte) (int, int, uint64) {
 	if f.isEncodedSingle() {
 		if f.singleTransChar == b {
+			if !f.validDest(int(f.singleTransAddr)) {
+				return -1, noneAddr, 0
+			}
 			return 0, int(f.singleTransAddr), f.singleTransOut
 		}
 		return -1, noneAddr, 0
 	}
-	transitionKeys := f.data[f.transBottom:f.transTop]
-	pos := bytes.IndexByte(transitionKeys, b)
-	if pos < 0 {
-		return -1, noneAddr, 0
+	var pos int
+	if f.indexed {
+		// any value not less than the number of transitions means absent
+		i := int(f.data[f.indexBottom+int(b)])
+		if i >= f.numTrans {
+			return -1, noneAddr, 0
+		}
+		pos = f.numTrans - i - 1
+	} else if f.dense {
+		i, ok := bitmapRank(f.data[f.bitmapBottom:f.bitmapBottom+transBitmapSize], b)
+		if !ok || i >= f.numTrans {
+			return -1, noneAddr, 0
+		}
+		pos = f.numTrans - i - 1
+	} else {
+		transitionKeys := f.data[f.transBottom:f.transTop]
+		pos = bytes.IndexByte(transitionKeys, b)
+		if pos < 0 {
+			return -1, noneAddr, 0
+		}
 	}
 	transDests := f.data[f.destBottom:f.destTop]
 	dest := int(readPackedUint(transDests[pos*f.transSize : pos*f.transSize+f.transSize]))
@@ -258,9 +355,19 @@ func (f *fstStateV1) TransitionFor(b byte) (int, int, uint64) {
 	if f.outSize > 0 {
 		out = readPackedUint(transVals[pos*f.outSize : pos*f.outSize+f.outSize])
 	}
+	if !f.validDest(dest) {
+		return -1, noneAddr, 0
+	}
 	return f.numTrans - pos - 1, dest, out
 }
 
+// validDest returns false when decoding safely and the transition dest is
+// not below this state.  States are always written before the states which
+// point to them, so this guarantees that traversals of corrupt data end.
+func (f *fstStateV1) validDest(dest int) bool {
+	return !f.safe || dest == emptyAddr || (dest > noneAddr && dest < f.bottom)
+}
+
 func (f *fstStateV1) String() string {
 	rv := ""
 	rv += fmt.Sprintf("State: %d (%#x)", f.top, f.top)
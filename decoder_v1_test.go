@@ -20,7 +20,7 @@ import (
 )
 
 func TestDecoderVersionError(t *testing.T) {
-	_, err := loadDecoder(629, nil)
+	_, err := loadDecoder(629, nil, false)
 	if err == nil {
 		t.Errorf("expected error loading decoder version 629, got nil")
 	}
@@ -411,7 +411,7 @@ func TestFSTStateFinalOutput(t *testing.T) {
 
 func TestDecodeStateZero(t *testing.T) {
 	var state fstStateV1
-	err := state.at(nil, 0)
+	err := state.at(nil, 0, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -425,7 +425,7 @@ func TestDecodeStateZero(t *testing.T) {
 
 func TestDecodeAtInvalid(t *testing.T) {
 	var state fstStateV1
-	err := state.at(nil, 15)
+	err := state.at(nil, 15, false)
 	if err == nil {
 		t.Errorf("expected error invalid address, got nil")
 	}
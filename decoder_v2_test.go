@@ -0,0 +1,108 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+func TestRoundTripV2(t *testing.T) {
+	opts := &BuilderOpts{
+		Encoder:           versionV2,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}
+	vals := randomValues(thousandTestWords)
+	dataV1 := buildTestFST(t, nil, thousandTestWords, vals)
+	dataV2 := buildTestFST(t, opts, thousandTestWords, vals)
+
+	// v2 is v1 with a different version and a trailing checksum
+	if len(dataV2) != len(dataV1)+checksumSize {
+		t.Fatalf("expected v2 len %d, got %d", len(dataV1)+checksumSize, len(dataV2))
+	}
+	if !bytes.Equal(dataV1[8:], dataV2[8:len(dataV1)]) {
+		t.Errorf("expected v2 to have same states and footer as v1")
+	}
+	crc := crc32.Checksum(dataV2[:len(dataV1)], castagnoliTable)
+	if binary.LittleEndian.Uint32(dataV2[len(dataV1):]) != crc {
+		t.Errorf("expected checksum %#x", crc)
+	}
+
+	fst, err := Load(dataV2)
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	if fst.Version() != versionV2 {
+		t.Errorf("expected version 2, got %d", fst.Version())
+	}
+	if !fst.HasChecksum() {
+		t.Errorf("expected v2 to have checksum")
+	}
+	if fst.Len() != len(thousandTestWords) {
+		t.Errorf("expected len %d, got %d", len(thousandTestWords), fst.Len())
+	}
+	for i, word := range thousandTestWords {
+		v, exists, err := fst.Get([]byte(word))
+		if err != nil {
+			t.Fatalf("error getting %s: %v", word, err)
+		}
+		if !exists || v != vals[i] {
+			t.Errorf("expected %s to have value %d, got %d %t", word, vals[i], v, exists)
+		}
+	}
+}
+
+func TestBuilderResetV2(t *testing.T) {
+	opts := &BuilderOpts{
+		Encoder:           versionV2,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}
+	var buf bytes.Buffer
+	b, err := New(&buf, opts)
+	if err != nil {
+		t.Fatalf("error creating builder: %v", err)
+	}
+	err = insertStringMap(b, smallSample)
+	if err != nil {
+		t.Fatalf("error building: %v", err)
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatalf("error closing: %v", err)
+	}
+	first := append([]byte(nil), buf.Bytes()...)
+
+	// reset must also reset the checksum
+	buf.Reset()
+	err = b.Reset(&buf)
+	if err != nil {
+		t.Fatalf("error resetting: %v", err)
+	}
+	err = insertStringMap(b, smallSample)
+	if err != nil {
+		t.Fatalf("error building: %v", err)
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatalf("error closing: %v", err)
+	}
+	if !bytes.Equal(first, buf.Bytes()) {
+		t.Errorf("expected identical output after reset")
+	}
+}
@@ -0,0 +1,52 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+func init() {
+	registerDecoder(versionV3, func(data []byte, safe bool) decoder {
+		d := newDecoderV3(data)
+		d.safe = safe
+		return d
+	})
+}
+
+type decoderV3 struct {
+	*decoderV1
+}
+
+func newDecoderV3(data []byte) *decoderV3 {
+	return &decoderV3{
+		decoderV1: &decoderV1{
+			data:                data,
+			footerSize:          footerSizeV2,
+			transIndexThreshold: transIndexThreshold,
+		},
+	}
+}
+
+func (d *decoderV3) checksum() (stored uint32, computed uint32, offset int) {
+	if len(d.data) < checksumSize {
+		return 0, 0, 0
+	}
+	offset = len(d.data) - checksumSize
+	stored = binary.LittleEndian.Uint32(d.data[offset:])
+	computed = maskChecksum(crc32.Checksum(d.data[:offset], castagnoliTable))
+	return stored, computed, offset
+}
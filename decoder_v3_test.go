@@ -0,0 +1,322 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var v3Opts = &BuilderOpts{
+	Encoder:           versionV3,
+	RegistryTableSize: 10000,
+	RegistryMRUSize:   2,
+}
+
+// burntSushiFooter appends the footer and masked checksum of the
+// BurntSushi/fst format, computed independently of the encoder.
+func burntSushiFooter(data []byte, count, root uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], count)
+	data = append(data, buf[:]...)
+	binary.LittleEndian.PutUint64(buf[:], root)
+	data = append(data, buf[:]...)
+	sum := crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))
+	sum = ((sum >> 15) | (sum << 17)) + 0xa282ead8
+	binary.LittleEndian.PutUint32(buf[:], sum)
+	return append(data, buf[:4]...)
+}
+
+func burntSushiHeader() []byte {
+	header := make([]byte, 16)
+	header[0] = 3
+	return header
+}
+
+// TestBurntSushiHandEncoded compares the encoder output with bytes
+// assembled by hand following the node layout of BurntSushi/fst.
+func TestBurntSushiHandEncoded(t *testing.T) {
+	// single transition states, no outputs on the second
+	one := burntSushiHeader()
+	one = append(one, 0x00, 0x10) // delta to empty (0), pack sizes
+	if c := encodeCommon('b'); c != 0 {
+		one = append(one, 0x80|c)
+	} else {
+		one = append(one, 'b', 0x80)
+	}
+	next := len(one) - 1
+	start := len(one)
+	one = append(one, 0x05, byte(start-next), 0x11) // out, delta, pack sizes
+	if c := encodeCommon('a'); c != 0 {
+		one = append(one, 0x80|c)
+	} else {
+		one = append(one, 'a', 0x80)
+	}
+	one = burntSushiFooter(one, 1, uint64(len(one)-1))
+
+	// multiple transitions with outputs
+	many := burntSushiHeader()
+	many = append(many,
+		0x02, 0x01, // outputs (reversed)
+		0x00, 0x00, // deltas (reversed)
+		'b', 'a', // inputs (reversed)
+		0x11, // pack sizes
+		0x02) // 2 transitions, not final
+	many = burntSushiFooter(many, 2, 23)
+
+	// more than 32 transitions, so a transition index is present
+	var wideKeys []string
+	wide := burntSushiHeader()
+	for i := 0; i < 33; i++ {
+		wideKeys = append(wideKeys, string(rune('A'+i)))
+		wide = append(wide, 0x00) // deltas
+	}
+	for i := 32; i >= 0; i-- {
+		wide = append(wide, byte('A'+i)) // inputs (reversed)
+	}
+	index := bytes.Repeat([]byte{255}, 256)
+	for i := 0; i < 33; i++ {
+		index['A'+i] = byte(i)
+	}
+	wide = append(wide, index...)
+	wide = append(wide, 0x10, 33) // pack sizes, 33 transitions
+	wide = burntSushiFooter(wide, 33, uint64(len(wide)-1))
+
+	tests := []struct {
+		desc string
+		keys []string
+		vals []uint64
+		want []byte
+	}{
+		{"one", []string{"ab"}, []uint64{5}, one},
+		{"many", []string{"a", "b"}, []uint64{1, 2}, many},
+		{"wide", wideKeys, make([]uint64, len(wideKeys)), wide},
+		{"empty", nil, nil, burntSushiFooter(append(burntSushiHeader(), 0, 0, 0), 0, 18)},
+		{"empty key", []string{""}, []uint64{0}, burntSushiFooter(burntSushiHeader(), 1, 0)},
+	}
+	for _, test := range tests {
+		got := buildTestFST(t, v3Opts, test.keys, test.vals)
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%s: expected\n% x\ngot\n% x", test.desc, test.want, got)
+			continue
+		}
+		fst, err := Load(got)
+		if err != nil {
+			t.Fatalf("%s: error loading: %v", test.desc, err)
+		}
+		for i, key := range test.keys {
+			val, ok, err := fst.Get([]byte(key))
+			if err != nil || !ok || val != test.vals[i] {
+				t.Errorf("%s: expected %s -> %d, got %d %t %v",
+					test.desc, key, test.vals[i], val, ok, err)
+			}
+		}
+		err = fst.Verify()
+		if err != nil {
+			t.Errorf("%s: verify: %v", test.desc, err)
+		}
+	}
+}
+
+func TestBurntSushiTransIndex(t *testing.T) {
+	// one state with all 256 transitions, another with 40
+	var keys []string
+	var vals []uint64
+	for i := 0; i < 256; i++ {
+		keys = append(keys, string([]byte{'a', byte(i)}))
+		vals = append(vals, uint64(i))
+	}
+	for i := 0; i < 40; i++ {
+		keys = append(keys, string([]byte{'b', byte(2 * i)}))
+		vals = append(vals, uint64(1000+i))
+	}
+	data := buildTestFST(t, v3Opts, keys, vals)
+	fst, err := LoadWithOpts(data, &LoadOpts{SafeDecode: true})
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	for i, key := range keys {
+		val, ok, err := fst.Get([]byte(key))
+		if err != nil || !ok || val != vals[i] {
+			t.Errorf("expected %q -> %d, got %d %t %v", key, vals[i], val, ok, err)
+		}
+	}
+	for i := 0; i < 40; i++ {
+		key := []byte{'b', byte(2*i + 1)}
+		_, ok, err := fst.Get(key)
+		if err != nil || ok {
+			t.Errorf("expected %q not found, got %t %v", key, ok, err)
+		}
+	}
+	err = fst.Verify()
+	if err != nil {
+		t.Errorf("verify: %v", err)
+	}
+
+	var got []string
+	itr, err := fst.Iterator(nil, nil)
+	for err == nil {
+		key, _ := itr.Current()
+		got = append(got, string(key))
+		err = itr.Next()
+	}
+	if err != ErrIteratorDone {
+		t.Fatalf("iterator error: %v", err)
+	}
+	if len(got) != len(keys) {
+		t.Fatalf("expected %d keys, got %d", len(keys), len(got))
+	}
+	for i := range keys {
+		if got[i] != keys[i] {
+			t.Errorf("expected key %d %q, got %q", i, keys[i], got[i])
+		}
+	}
+}
+
+func TestBurntSushiChecksum(t *testing.T) {
+	data := buildTestFST(t, v3Opts, []string{"cat", "dog"}, []uint64{1, 2})
+	data[17]++
+	fst, err := Load(data)
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	if !fst.HasChecksum() {
+		t.Errorf("expected version 3 to have a checksum")
+	}
+	err = fst.Verify()
+	if err == nil {
+		t.Errorf("expected checksum error, got nil")
+	}
+}
+
+func TestBurntSushiNoMetadata(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, &BuilderOpts{
+		Encoder:  versionV3,
+		Metadata: map[string][]byte{"a": []byte("b")},
+	})
+	if err == nil {
+		t.Errorf("expected error creating version 3 builder with metadata")
+	}
+
+	// the type field is reserved for the user in this format
+	data := buildTestFST(t, v3Opts, []string{"cat"}, []uint64{1})
+	data[8] = 1
+	fst, err := Load(data)
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	if fst.Metadata() != nil {
+		t.Errorf("expected no metadata, got %v", fst.Metadata())
+	}
+	val, ok, err := fst.Get([]byte("cat"))
+	if err != nil || !ok || val != 1 {
+		t.Errorf("expected cat -> 1, got %d %t %v", val, ok, err)
+	}
+}
+
+func loadCorpus(t *testing.T, path string) ([]string, []uint64) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var keys []string
+	var vals []uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.LastIndexByte(line, ',')
+		if i < 0 {
+			t.Fatalf("invalid corpus line %q", line)
+		}
+		val, err := strconv.ParseUint(line[i+1:], 10, 64)
+		if err != nil {
+			t.Fatalf("invalid corpus line %q: %v", line, err)
+		}
+		keys = append(keys, line[:i])
+		vals = append(vals, val)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return keys, vals
+}
+
+// TestBurntSushiGolden checks that each corpus in testdata/burntsushi builds
+// to exactly the bytes of the corresponding golden file, written by the
+// Rust fst crate, and that the golden file can be opened and contains the
+// corpus.  Corpora without a golden file are skipped.
+func TestBurntSushiGolden(t *testing.T) {
+	corpora, err := filepath.Glob(filepath.Join("testdata", "burntsushi", "*.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(corpora) == 0 {
+		t.Fatalf("no corpus found")
+	}
+	for _, corpus := range corpora {
+		corpus := corpus
+		t.Run(filepath.Base(corpus), func(t *testing.T) {
+			golden := strings.TrimSuffix(corpus, ".csv") + ".fst"
+			want, err := ioutil.ReadFile(golden)
+			if os.IsNotExist(err) {
+				t.Skipf("no golden file %s, see testdata/burntsushi/README.md", golden)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys, vals := loadCorpus(t, corpus)
+			got := buildTestFST(t, v3Opts, keys, vals)
+			if !bytes.Equal(got, want) {
+				t.Errorf("built fst differs from %s", golden)
+			}
+
+			fst, err := Open(golden)
+			if err != nil {
+				t.Fatalf("error opening %s: %v", golden, err)
+			}
+			defer func() {
+				_ = fst.Close()
+			}()
+			if fst.Version() != versionV3 {
+				t.Errorf("expected version %d, got %d", versionV3, fst.Version())
+			}
+			if fst.Len() != len(keys) {
+				t.Errorf("expected len %d, got %d", len(keys), fst.Len())
+			}
+			for i, key := range keys {
+				val, ok, err := fst.Get([]byte(key))
+				if err != nil || !ok || val != vals[i] {
+					t.Errorf("expected %s -> %d, got %d %t %v",
+						key, vals[i], val, ok, err)
+				}
+			}
+			err = fst.Verify()
+			if err != nil {
+				t.Errorf("verify: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"encoding/binary"
+)
+
+func init() {
+	registerDecoder(versionV4, func(data []byte, safe bool) decoder {
+		d := newDecoderV4(data)
+		d.safe = safe
+		return d
+	})
+}
+
+type decoderV4 struct {
+	*decoderV2
+}
+
+func newDecoderV4(data []byte) *decoderV4 {
+	rv := &decoderV4{
+		decoderV2: &decoderV2{
+			decoderV1: &decoderV1{
+				data:       data,
+				footerSize: footerSizeV4,
+			},
+		},
+	}
+	if len(data) >= footerSizeV4 {
+		footer := data[len(data)-footerSizeV4:]
+		threshold := binary.LittleEndian.Uint64(footer[footerSizeV1:])
+		// an invalid threshold is treated as no dense states, the
+		// checksum validated by Verify() covers the footer
+		if threshold <= 256 {
+			rv.denseThreshold = int(threshold)
+		}
+	}
+	return rv
+}
@@ -0,0 +1,268 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// denseTestKeys returns sorted random keys over a large alphabet, so that
+// many states have a large number of transitions
+func denseTestKeys(n, length, alphabet int) []string {
+	rng := rand.New(rand.NewSource(42))
+	set := map[string]struct{}{}
+	for len(set) < n {
+		key := make([]byte, length)
+		for i := range key {
+			key[i] = byte(rng.Intn(alphabet))
+		}
+		set[string(key)] = struct{}{}
+	}
+	rv := make([]string, 0, len(set))
+	for k := range set {
+		rv = append(rv, k)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+func v4Opts(threshold int) *BuilderOpts {
+	return &BuilderOpts{
+		Encoder:           versionV4,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+		DenseThreshold:    threshold,
+	}
+}
+
+func TestRoundTripV4(t *testing.T) {
+	keys := denseTestKeys(5000, 3, 256)
+	vals := randomValues(keys)
+	keys = append([]string{""}, keys...)
+	vals = append([]uint64{7}, vals...)
+
+	for _, threshold := range []int{0, 1, 2, 16, 255, 256} {
+		data := buildTestFST(t, v4Opts(threshold), keys, vals)
+		for _, safe := range []bool{false, true} {
+			fst, err := LoadWithOpts(data, &LoadOpts{SafeDecode: safe})
+			if err != nil {
+				t.Fatalf("threshold %d: error loading: %v", threshold, err)
+			}
+			if !fst.HasChecksum() {
+				t.Errorf("threshold %d: expected checksum", threshold)
+			}
+			for i, key := range keys {
+				val, ok, err := fst.Get([]byte(key))
+				if err != nil || !ok || val != vals[i] {
+					t.Fatalf("threshold %d: expected %q -> %d, got %d %t %v",
+						threshold, key, vals[i], val, ok, err)
+				}
+				// all other keys have length 3, so this is never present
+				missing := append([]byte(key), 0xff, 0xff)
+				_, ok, err = fst.Get(missing)
+				if err != nil || ok {
+					t.Fatalf("threshold %d: expected %q not found, got %t %v",
+						threshold, missing, ok, err)
+				}
+			}
+
+			var got []string
+			itr, err := fst.Iterator(nil, nil)
+			for err == nil {
+				key, _ := itr.Current()
+				got = append(got, string(key))
+				err = itr.Next()
+			}
+			if err != ErrIteratorDone {
+				t.Fatalf("threshold %d: iterator error: %v", threshold, err)
+			}
+			if len(got) != len(keys) {
+				t.Fatalf("threshold %d: expected %d keys, got %d", threshold, len(keys), len(got))
+			}
+
+			err = fst.Verify()
+			if err != nil {
+				t.Errorf("threshold %d: verify: %v", threshold, err)
+			}
+		}
+	}
+}
+
+func TestV4Size(t *testing.T) {
+	keys := denseTestKeys(5000, 3, 200)
+	vals := randomValues(keys)
+	v2 := buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV2,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}, keys, vals)
+
+	// no state has 256 transitions, so only the footer grows
+	v4 := buildTestFST(t, v4Opts(256), keys, vals)
+	if len(v4) != len(v2)+footerSizeV4-footerSizeV2 {
+		t.Errorf("expected size %d, got %d", len(v2)+footerSizeV4-footerSizeV2, len(v4))
+	}
+
+	// every state with multiple transitions has a bitmap
+	v4 = buildTestFST(t, v4Opts(2), keys, vals)
+	if len(v4) <= len(v2)+footerSizeV4-footerSizeV2 {
+		t.Errorf("expected size larger than %d, got %d", len(v2), len(v4))
+	}
+}
+
+func TestV4InvalidThreshold(t *testing.T) {
+	for _, threshold := range []int{-1, 257} {
+		_, err := New(&bytes.Buffer{}, v4Opts(threshold))
+		if err == nil {
+			t.Errorf("expected error for threshold %d, got nil", threshold)
+		}
+	}
+}
+
+func TestBitmapRank(t *testing.T) {
+	bitmap := make([]byte, transBitmapSize)
+	var set []byte
+	for i := 0; i < 256; i += 7 {
+		bitmap[i/8] |= 1 << uint(i%8)
+		set = append(set, byte(i))
+	}
+	for i := 0; i < 256; i++ {
+		rank, ok := bitmapRank(bitmap, byte(i))
+		pos := bytes.IndexByte(set, byte(i))
+		if ok != (pos >= 0) {
+			t.Errorf("expected %d set %t, got %t", i, pos >= 0, ok)
+		}
+		if ok && rank != pos {
+			t.Errorf("expected %d rank %d, got %d", i, pos, rank)
+		}
+	}
+}
+
+var v1BenchOpts = &BuilderOpts{
+	Encoder:           versionV1,
+	RegistryTableSize: 10000,
+	RegistryMRUSize:   2,
+}
+
+// checkDenseRoot fails unless the root state of the FST uses the lookup
+// expected for its version: the v4 bitmap, the v3 index, or (v1) a scan.
+func checkDenseRoot(b *testing.B, fst *FST) {
+	state, err := fst.decoder.stateAt(fst.decoder.getRoot(), nil)
+	if err != nil {
+		b.Fatalf("error decoding root: %v", err)
+	}
+	s := state.(*fstStateV1)
+	if s.dense != (fst.Version() == versionV4) || s.indexed != (fst.Version() == versionV3) {
+		b.Fatalf("version %d root: unexpected lookup, dense %t indexed %t",
+			fst.Version(), s.dense, s.indexed)
+	}
+}
+
+// benchmarkDenseGet looks up keys in an FST whose first two levels of
+// states are dense.  With miss, the last byte of each key is outside of
+// the alphabet, so the last lookup finds no transition, which is where
+// the bitmap (or v3 index) avoids scanning all of the transitions.
+func benchmarkDenseGet(b *testing.B, opts *BuilderOpts, miss bool) {
+	keys := denseTestKeys(100000, 3, 200)
+	data := buildTestFST(b, opts, keys, randomValues(keys))
+	fst, err := Load(data)
+	if err != nil {
+		b.Fatalf("error loading: %v", err)
+	}
+	checkDenseRoot(b, fst)
+	lookups := make([][]byte, 0, 1000)
+	for _, key := range keys[:1000] {
+		lookup := []byte(key)
+		if miss {
+			lookup[2] = 200 + lookup[2]%56
+		}
+		lookups = append(lookups, lookup)
+	}
+	reader, err := fst.Reader()
+	if err != nil {
+		b.Fatalf("error creating reader: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, exists, err := reader.Get(lookups[i%len(lookups)])
+		if err != nil || exists == miss {
+			b.Fatalf("unexpected lookup result %t %v", exists, err)
+		}
+	}
+}
+
+func BenchmarkDenseGetV1(b *testing.B)     { benchmarkDenseGet(b, v1BenchOpts, false) }
+func BenchmarkDenseGetV3(b *testing.B)     { benchmarkDenseGet(b, v3Opts, false) }
+func BenchmarkDenseGetV4(b *testing.B)     { benchmarkDenseGet(b, v4Opts(0), false) }
+func BenchmarkDenseGetMissV1(b *testing.B) { benchmarkDenseGet(b, v1BenchOpts, true) }
+func BenchmarkDenseGetMissV3(b *testing.B) { benchmarkDenseGet(b, v3Opts, true) }
+func BenchmarkDenseGetMissV4(b *testing.B) { benchmarkDenseGet(b, v4Opts(0), true) }
+
+// benchmarkDenseTransitionFor looks up the transitions of a root state
+// with a transition for every even byte, with miss the odd bytes.
+func benchmarkDenseTransitionFor(b *testing.B, opts *BuilderOpts, miss bool) {
+	var keys []string
+	for i := 0; i < 256; i += 2 {
+		keys = append(keys, string([]byte{byte(i)}))
+	}
+	data := buildTestFST(b, opts, keys, randomValues(keys))
+	fst, err := Load(data)
+	if err != nil {
+		b.Fatalf("error loading: %v", err)
+	}
+	checkDenseRoot(b, fst)
+	state, err := fst.decoder.stateAt(fst.decoder.getRoot(), nil)
+	if err != nil {
+		b.Fatalf("error decoding root: %v", err)
+	}
+	var odd byte
+	if miss {
+		odd = 1
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, addr, _ := state.TransitionFor(byte(i)&^1 | odd)
+		if (addr == noneAddr) != miss {
+			b.Fatalf("unexpected transition for %d", byte(i)&^1|odd)
+		}
+	}
+}
+
+func BenchmarkDenseTransitionForV1(b *testing.B) {
+	benchmarkDenseTransitionFor(b, v1BenchOpts, false)
+}
+
+func BenchmarkDenseTransitionForV3(b *testing.B) {
+	benchmarkDenseTransitionFor(b, v3Opts, false)
+}
+
+func BenchmarkDenseTransitionForV4(b *testing.B) {
+	benchmarkDenseTransitionFor(b, v4Opts(0), false)
+}
+
+func BenchmarkDenseTransitionForMissV1(b *testing.B) {
+	benchmarkDenseTransitionFor(b, v1BenchOpts, true)
+}
+
+func BenchmarkDenseTransitionForMissV3(b *testing.B) {
+	benchmarkDenseTransitionFor(b, v3Opts, true)
+}
+
+func BenchmarkDenseTransitionForMissV4(b *testing.B) {
+	benchmarkDenseTransitionFor(b, v4Opts(0), true)
+}
@@ -33,31 +33,47 @@ func init() {
 }
 
 type encoderV1 struct {
-	bw *writer
+	bw  *writer
+	ver int
+
+	// cw is only used by versions which end with a checksum
+	cw *checksumWriter
+
+	// maskChecksum selects the masked form of the checksum
+	maskedChecksum bool
+
+	// transIndexThreshold is non-zero for versions where states with more
+	// than this number of transitions also store a transition index
+	transIndexThreshold int
+
+	// denseThreshold is non-zero for versions where states with at least
+	// this number of transitions also store a transition bitmap, it is
+	// written in the footer
+	denseThreshold int
 }
 
 func newEncoderV1(w io.Writer) *encoderV1 {
 	return &encoderV1{
-		bw: newWriter(w),
+		bw:  newWriter(w),
+		ver: versionV1,
 	}
 }
 
 func (e *encoderV1) reset(w io.Writer) {
+	if e.cw != nil {
+		e.cw.Reset(w)
+		e.bw.Reset(e.cw)
+		return
+	}
 	e.bw.Reset(w)
 }
 
-func (e *encoderV1) start() error {
-	header := make([]byte, headerSize)
-	binary.LittleEndian.PutUint64(header, versionV1)
-	binary.LittleEndian.PutUint64(header[8:], uint64(0)) // type
-	n, err := e.bw.Write(header)
-	if err != nil {
-		return err
-	}
-	if n != headerSize {
-		return fmt.Errorf("short write of header %d/%d", n, headerSize)
-	}
-	return nil
+func (e *encoderV1) written() int {
+	return e.bw.counter
+}
+
+func (e *encoderV1) start(meta []byte) error {
+	return encodeHeader(e.bw, e.ver, meta)
 }
 
 func (e *encoderV1) encodeState(s *builderNode, lastAddr int) (int, error) {
@@ -170,6 +186,22 @@ func (e *encoderV1) encodeStateMany(s *builderNode) (int, error) {
 		}
 	}
 
+	// output transition index (if needed)
+	if e.transIndexThreshold > 0 && len(s.trans) > e.transIndexThreshold {
+		err := e.encodeTransIndex(s)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// output transition bitmap (if needed)
+	if e.denseThreshold > 0 && len(s.trans) >= e.denseThreshold {
+		err := e.encodeTransBitmap(s)
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	packSize := encodePackSize(transPackSize, outPackSize)
 	err := e.bw.WriteByte(packSize)
 	if err != nil {
@@ -208,20 +240,85 @@ func (e *encoderV1) encodeStateMany(s *builderNode) (int, error) {
 	return e.bw.counter - 1, nil
 }
 
+// encodeTransIndex writes the index from input byte to transition number,
+// a value of 255 indicates there is no transition for that byte (except
+// when there are 256 transitions).
+func (e *encoderV1) encodeTransIndex(s *builderNode) error {
+	index := make([]byte, transIndexSize)
+	for i := range index {
+		index[i] = 255
+	}
+	for i := range s.trans {
+		index[s.trans[i].in] = byte(i)
+	}
+	n, err := e.bw.Write(index)
+	if err != nil {
+		return err
+	}
+	if n != transIndexSize {
+		return fmt.Errorf("short write of transition index %d/%d", n, transIndexSize)
+	}
+	return nil
+}
+
+// encodeTransBitmap writes a bitmap with a bit set for each input byte
+// which has a transition, as 4 uint64 little-endian.
+func (e *encoderV1) encodeTransBitmap(s *builderNode) error {
+	var bitmap [transBitmapSize]byte
+	for i := range s.trans {
+		in := s.trans[i].in
+		bitmap[in/8] |= 1 << (in % 8)
+	}
+	n, err := e.bw.Write(bitmap[:])
+	if err != nil {
+		return err
+	}
+	if n != transBitmapSize {
+		return fmt.Errorf("short write of transition bitmap %d/%d", n, transBitmapSize)
+	}
+	return nil
+}
+
 func (e *encoderV1) finish(count, rootAddr int) error {
-	footer := make([]byte, footerSizeV1)
+	footer := make([]byte, footerSizeV1, footerSizeV1+8)
 	binary.LittleEndian.PutUint64(footer, uint64(count))        // root addr
 	binary.LittleEndian.PutUint64(footer[8:], uint64(rootAddr)) // root addr
+	if e.denseThreshold > 0 {
+		footer = footer[:footerSizeV1+8]
+		binary.LittleEndian.PutUint64(footer[footerSizeV1:], uint64(e.denseThreshold))
+	}
 	n, err := e.bw.Write(footer)
 	if err != nil {
 		return err
 	}
-	if n != footerSizeV1 {
-		return fmt.Errorf("short write of footer %d/%d", n, footerSizeV1)
+	if n != len(footer) {
+		return fmt.Errorf("short write of footer %d/%d", n, len(footer))
 	}
 	err = e.bw.Flush()
 	if err != nil {
 		return err
 	}
+	if e.cw != nil {
+		return e.finishChecksum()
+	}
 	return nil
 }
+
+// finishChecksum writes the checksum of everything written so far, it
+// requires that the buffered writer has already been flushed.
+func (e *encoderV1) finishChecksum() error {
+	buf := make([]byte, checksumSize)
+	crc := e.cw.crc
+	if e.maskedChecksum {
+		crc = maskChecksum(crc)
+	}
+	binary.LittleEndian.PutUint32(buf, crc)
+	n, err := e.bw.Write(buf)
+	if err != nil {
+		return err
+	}
+	if n != checksumSize {
+		return fmt.Errorf("short write of checksum %d/%d", n, checksumSize)
+	}
+	return e.bw.Flush()
+}
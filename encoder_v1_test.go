@@ -41,7 +41,7 @@ func TestEncoderStart(t *testing.T) {
 
 	var buf bytes.Buffer
 	e := newEncoderV1(&buf)
-	err := e.start()
+	err := e.start(nil)
 	if err != nil {
 		t.Fatal(err)
 	}
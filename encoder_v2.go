@@ -0,0 +1,40 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"io"
+)
+
+// versionV2 uses the same state encoding as v1, but the footer is followed
+// by a CRC32C checksum of all of the preceding bytes.
+const versionV2 = 2
+const checksumSize = 4
+const footerSizeV2 = footerSizeV1 + checksumSize
+
+func init() {
+	registerEncoder(versionV2, func(w io.Writer) encoder {
+		return newEncoderV2(w)
+	})
+}
+
+func newEncoderV2(w io.Writer) *encoderV1 {
+	cw := newChecksumWriter(w)
+	return &encoderV1{
+		bw:  newWriter(cw),
+		ver: versionV2,
+		cw:  cw,
+	}
+}
@@ -0,0 +1,60 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"fmt"
+	"io"
+)
+
+// versionV3 is the format written by version 0.4 of the BurntSushi/fst
+// Rust crate.  It uses the same state encoding as v1, except that states
+// with more than transIndexThreshold transitions also store an index from
+// input byte to transition, and the footer is followed by a masked CRC32C
+// checksum of all of the preceding bytes.  This format has no metadata
+// section.
+const versionV3 = 3
+const transIndexThreshold = 32
+const transIndexSize = 256
+
+func init() {
+	registerEncoder(versionV3, func(w io.Writer) encoder {
+		return newEncoderV3(w)
+	})
+}
+
+type encoderV3 struct {
+	*encoderV1
+}
+
+func newEncoderV3(w io.Writer) *encoderV3 {
+	cw := newChecksumWriter(w)
+	return &encoderV3{
+		encoderV1: &encoderV1{
+			bw:                  newWriter(cw),
+			ver:                 versionV3,
+			cw:                  cw,
+			maskedChecksum:      true,
+			transIndexThreshold: transIndexThreshold,
+		},
+	}
+}
+
+func (e *encoderV3) start(meta []byte) error {
+	if meta != nil {
+		return fmt.Errorf("metadata is not supported by version %d", versionV3)
+	}
+	return e.encoderV1.start(nil)
+}
@@ -0,0 +1,89 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// versionV4 uses the same encoding as v2, except that states with at least
+// the dense threshold number of transitions also store a bitmap of the
+// input bytes which have a transition.  This allows the transition for an
+// input byte to be found directly, instead of by scanning the transition
+// bytes.  The threshold is written in the footer, after the number of keys
+// and root address, and before the checksum.
+const versionV4 = 4
+const footerSizeV4 = footerSizeV2 + 8
+const transBitmapSize = 32
+const defaultDenseThreshold = 16
+
+func init() {
+	registerEncoder(versionV4, func(w io.Writer) encoder {
+		return newEncoderV4(w)
+	})
+}
+
+// denseEncoder is implemented by encoders which support a configurable
+// dense state threshold.
+type denseEncoder interface {
+	setDenseThreshold(threshold int) error
+}
+
+type encoderV4 struct {
+	*encoderV1
+}
+
+func newEncoderV4(w io.Writer) *encoderV4 {
+	cw := newChecksumWriter(w)
+	return &encoderV4{
+		encoderV1: &encoderV1{
+			bw:             newWriter(cw),
+			ver:            versionV4,
+			cw:             cw,
+			denseThreshold: defaultDenseThreshold,
+		},
+	}
+}
+
+func (e *encoderV4) setDenseThreshold(threshold int) error {
+	if threshold == 0 {
+		threshold = defaultDenseThreshold
+	}
+	if threshold < 1 || threshold > 256 {
+		return fmt.Errorf("invalid dense threshold %d, must be 1-256", threshold)
+	}
+	e.denseThreshold = threshold
+	return nil
+}
+
+// bitmapRank returns the number of bits set in the bitmap before the bit
+// for the input byte, which is the number of the transition for that byte,
+// and whether or not the bit for the input byte is set.
+func bitmapRank(bitmap []byte, in byte) (int, bool) {
+	word := int(in / 64)
+	w := binary.LittleEndian.Uint64(bitmap[word*8:])
+	bit := uint64(1) << (in % 64)
+	if w&bit == 0 {
+		return 0, false
+	}
+	rank := bits.OnesCount64(w & (bit - 1))
+	for i := 0; i < word; i++ {
+		rank += bits.OnesCount64(binary.LittleEndian.Uint64(bitmap[i*8:]))
+	}
+	return rank, true
+}
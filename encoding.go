@@ -22,24 +22,35 @@ import (
 
 const headerSize = 16
 
+// typeMetadata is set in the header type field when the header is
+// immediately followed by a user metadata section.
+const typeMetadata = 1 << 0
+
 type encoderConstructor func(w io.Writer) encoder
-type decoderConstructor func([]byte) decoder
+
+// decoderConstructor builds a decoder for the provided data, when safe
+// is true the decoder MUST validate all addresses and lengths read from
+// the data, returning errors instead of panicking.
+type decoderConstructor func(data []byte, safe bool) decoder
 
 var encoders = map[int]encoderConstructor{}
 var decoders = map[int]decoderConstructor{}
 
 type encoder interface {
-	start() error
+	start(meta []byte) error
 	encodeState(s *builderNode, addr int) (int, error)
 	finish(count, rootAddr int) error
 	reset(w io.Writer)
+
+	// written returns the number of bytes encoded so far
+	written() int
 }
 
 func loadEncoder(ver int, w io.Writer) (encoder, error) {
 	if cons, ok := encoders[ver]; ok {
 		return cons(w), nil
 	}
-	return nil, fmt.Errorf("no encoder for version %d registered", ver)
+	return nil, &UnsupportedVersionError{Version: ver, what: "encoder"}
 }
 
 func registerEncoder(ver int, cons encoderConstructor) {
@@ -49,23 +60,54 @@ func registerEncoder(ver int, cons encoderConstructor) {
 type decoder interface {
 	getRoot() int
 	getLen() int
+	getFooterOffset() int
 	stateAt(addr int, prealloc fstState) (fstState, error)
 }
 
-func loadDecoder(ver int, data []byte) (decoder, error) {
+func loadDecoder(ver int, data []byte, safe bool) (decoder, error) {
 	if cons, ok := decoders[ver]; ok {
-		return cons(data), nil
+		return cons(data, safe), nil
 	}
-	return nil, fmt.Errorf("no decoder for version %d registered", ver)
+	return nil, &UnsupportedVersionError{Version: ver, what: "decoder"}
 }
 
 func registerDecoder(ver int, cons decoderConstructor) {
 	decoders[ver] = cons
 }
 
+// encodeHeader writes the header for the provided version, followed by the
+// (optional) metadata section, which is the 8 byte length of the encoded
+// metadata (uint64 little-endian) followed by the encoded metadata.
+func encodeHeader(bw *writer, ver int, meta []byte) error {
+	header := make([]byte, headerSize, headerSize+8)
+	binary.LittleEndian.PutUint64(header, uint64(ver))
+	if meta != nil {
+		binary.LittleEndian.PutUint64(header[8:], typeMetadata) // type
+		header = header[:headerSize+8]
+		binary.LittleEndian.PutUint64(header[headerSize:], uint64(len(meta)))
+	}
+	n, err := bw.Write(header)
+	if err != nil {
+		return err
+	}
+	if n != len(header) {
+		return fmt.Errorf("short write of header %d/%d", n, len(header))
+	}
+	if meta != nil {
+		n, err = bw.Write(meta)
+		if err != nil {
+			return err
+		}
+		if n != len(meta) {
+			return fmt.Errorf("short write of metadata %d/%d", n, len(meta))
+		}
+	}
+	return nil
+}
+
 func decodeHeader(header []byte) (ver int, typ int, err error) {
 	if len(header) < headerSize {
-		err = fmt.Errorf("invalid header < 16 bytes")
+		err = truncatedError(len(header), "invalid header < 16 bytes")
 		return
 	}
 	ver = int(binary.LittleEndian.Uint64(header[0:8]))
@@ -85,3 +127,28 @@ type fstState interface {
 	TransitionFor(b byte) (int, int, uint64)
 	TransitionAt(i int) byte
 }
+
+// decodeMetadataSection decodes the metadata section which immediately
+// follows the header, when the header type indicates it is present.  It
+// also returns the offset where the metadata section (if any) ends.  The
+// BurntSushi format (v3) has no metadata section, its type field is
+// reserved for the user.
+func decodeMetadataSection(data []byte, ver, typ int) (map[string][]byte, int, error) {
+	if ver == versionV3 || typ&typeMetadata == 0 {
+		return nil, headerSize, nil
+	}
+	if len(data) < headerSize+8 {
+		return nil, 0, truncatedError(len(data), "invalid metadata section, data too short")
+	}
+	l := binary.LittleEndian.Uint64(data[headerSize:])
+	if l > uint64(len(data)-headerSize-8) {
+		return nil, 0, truncatedError(headerSize,
+			fmt.Sprintf("invalid metadata section length %d", l))
+	}
+	end := headerSize + 8 + int(l)
+	meta, err := decodeMetadata(data[headerSize+8:end], headerSize+8)
+	if err != nil {
+		return nil, 0, err
+	}
+	return meta, end, nil
+}
@@ -0,0 +1,85 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedVersion is the category of errors returned when data is
+// encoded with a version for which no encoder or decoder is registered.
+// Use errors.Is(err, ErrUnsupportedVersion) to test for it.
+var ErrUnsupportedVersion = errors.New("unsupported version")
+
+// ErrCorrupt is the category of errors returned when data is found to be
+// corrupt.  Use errors.Is(err, ErrCorrupt) to test for it, and
+// errors.As(err, &corruptErr) to find the offset.
+var ErrCorrupt = errors.New("corrupt data")
+
+// ErrTruncated is the category of errors returned when data ends before
+// the end of a structure it describes, typically because a file was only
+// partially written or copied.  Use errors.Is(err, ErrTruncated) to test
+// for it.
+var ErrTruncated = errors.New("truncated data")
+
+// ErrClosed is returned by the methods of an FST, and of its iterators,
+// called after the FST has been closed.
+var ErrClosed = errors.New("fst closed")
+
+// CorruptError describes corrupt or truncated data.  Offset is the
+// position in the data where the problem was detected, and Err is the
+// category, either ErrCorrupt or ErrTruncated (nil means ErrCorrupt).
+type CorruptError struct {
+	Offset int
+	Msg    string
+	Err    error
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("%v at offset %d: %s", e.Unwrap(), e.Offset, e.Msg)
+}
+
+// Unwrap returns the category of this error.
+func (e *CorruptError) Unwrap() error {
+	if e.Err == nil {
+		return ErrCorrupt
+	}
+	return e.Err
+}
+
+// UnsupportedVersionError is returned when no encoder or decoder is
+// registered for the requested version.
+type UnsupportedVersionError struct {
+	Version int
+	what    string
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("no %s for version %d registered", e.what, e.Version)
+}
+
+// Unwrap returns ErrUnsupportedVersion.
+func (e *UnsupportedVersionError) Unwrap() error {
+	return ErrUnsupportedVersion
+}
+
+func truncatedError(offset int, msg string) error {
+	return &CorruptError{Offset: offset, Msg: msg, Err: ErrTruncated}
+}
+
+func corruptError(offset int, msg string) error {
+	return &CorruptError{Offset: offset, Msg: msg, Err: ErrCorrupt}
+}
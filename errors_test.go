@@ -0,0 +1,156 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestErrorsUnsupportedVersion(t *testing.T) {
+	data := make([]byte, 32)
+	binary.LittleEndian.PutUint64(data, 629)
+	_, err := Load(data)
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expected ErrUnsupportedVersion, got %v", err)
+	}
+	var uve *UnsupportedVersionError
+	if !errors.As(err, &uve) || uve.Version != 629 {
+		t.Errorf("expected UnsupportedVersionError for 629, got %#v", err)
+	}
+	if errors.Is(err, ErrCorrupt) || errors.Is(err, ErrTruncated) {
+		t.Errorf("expected only ErrUnsupportedVersion, got %v", err)
+	}
+
+	_, err = New(&bytes.Buffer{}, &BuilderOpts{Encoder: 629})
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected ErrUnsupportedVersion creating builder, got %v", err)
+	}
+}
+
+func TestErrorsTruncated(t *testing.T) {
+	data := buildTestFST(t, nil, []string{"cat", "dog", "fish"}, []uint64{1, 2, 3})
+	meta := buildTestFST(t, &BuilderOpts{
+		Encoder:           1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+		Metadata:          map[string][]byte{"creator": []byte("test")},
+	}, []string{"cat"}, []uint64{1})
+
+	tests := []struct {
+		desc string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short header", data[:15]},
+		{"header only", data[:16]},
+		{"short footer", data[:20]},
+		{"metadata length", meta[:20]},
+		{"metadata section", meta[:26]},
+	}
+	for _, test := range tests {
+		for _, safe := range []bool{false, true} {
+			_, err := LoadWithOpts(test.data, &LoadOpts{SafeDecode: safe})
+			if !errors.Is(err, ErrTruncated) {
+				t.Errorf("%s (safe %t): expected ErrTruncated, got %v",
+					test.desc, safe, err)
+			}
+			var ce *CorruptError
+			if !errors.As(err, &ce) {
+				t.Errorf("%s (safe %t): expected *CorruptError, got %#v",
+					test.desc, safe, err)
+			}
+		}
+	}
+}
+
+func TestErrorsCorrupt(t *testing.T) {
+	data := buildTestFST(t, nil, []string{"cat", "dog", "fish"}, []uint64{1, 2, 3})
+
+	// root address pointing past the footer
+	badRoot := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint64(badRoot[len(badRoot)-8:], uint64(len(data)))
+	_, err := LoadWithOpts(badRoot, &LoadOpts{SafeDecode: true})
+	if !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+	var ce *CorruptError
+	if !errors.As(err, &ce) {
+		t.Fatalf("expected *CorruptError, got %#v", err)
+	}
+	if ce.Offset != len(data)-footerSizeV1 {
+		t.Errorf("expected offset %d, got %d", len(data)-footerSizeV1, ce.Offset)
+	}
+	if errors.Is(err, ErrTruncated) {
+		t.Errorf("expected corrupt error not to be ErrTruncated")
+	}
+
+	// key count in the footer which does not match the data
+	badLen := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint64(badLen[len(badLen)-16:], 7)
+	fst, err := Load(badLen)
+	if err != nil {
+		t.Fatalf("unexpected error loading: %v", err)
+	}
+	err = fst.Verify()
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt from Verify, got %v", err)
+	}
+}
+
+func TestErrorsCorruptErrorDefault(t *testing.T) {
+	err := error(&CorruptError{Offset: 3, Msg: "bad"})
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected CorruptError without Err to be ErrCorrupt")
+	}
+	if errors.Is(err, ErrTruncated) {
+		t.Errorf("expected CorruptError without Err not to be ErrTruncated")
+	}
+}
+
+func TestErrorsContainer(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := NewContainerWriter(&buf)
+	if err != nil {
+		t.Fatalf("error creating container writer: %v", err)
+	}
+	buildContainer(t, c, map[string]map[string]uint64{"a": smallSample}, []string{"a"})
+	err = c.Close()
+	if err != nil {
+		t.Fatalf("error closing container writer: %v", err)
+	}
+	data := buf.Bytes()
+
+	_, err = LoadContainer(data[:containerHeaderSize])
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected ErrTruncated for short container, got %v", err)
+	}
+	_, err = LoadContainer(data[:len(data)-1])
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected ErrTruncated for truncated container, got %v", err)
+	}
+	_, err = LoadContainer(append([]byte("notvellum"), data[9:]...))
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt for bad header, got %v", err)
+	}
+	badVersion := append([]byte(nil), data...)
+	badVersion[8] = 9
+	_, err = LoadContainer(badVersion)
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected ErrUnsupportedVersion, got %v", err)
+	}
+}
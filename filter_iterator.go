@@ -0,0 +1,204 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"fmt"
+)
+
+// BasicIterator is the subset of the Iterator methods used by FilterIterator
+// and MapIterator, which is also implemented by MergeIterator and
+// ShardedIterator, so that they can be filtered or mapped too.
+type BasicIterator interface {
+	Current() ([]byte, uint64)
+	Next() error
+	Seek(key []byte) error
+	Close() error
+}
+
+// FilterFunc is used by a FilterIterator to choose which key/value pairs to
+// keep, it returns false for those to drop.
+type FilterFunc func(key []byte, val uint64) bool
+
+// MapFunc is used by a MapIterator to rewrite key/value pairs.  It may
+// return the key unchanged, or another key, as long as the keys returned
+// remain in lexicographic order.  The key returned is only used until the
+// next call of the MapFunc.
+type MapFunc func(key []byte, val uint64) ([]byte, uint64)
+
+// FilterIterator implements the Iterator interface by traversing another
+// Iterator, skipping the key/value pairs which a user-provided FilterFunc
+// drops.
+type FilterIterator struct {
+	itr  BasicIterator
+	f    FilterFunc
+	done bool
+}
+
+// NewFilterIterator creates a new FilterIterator over the provided Iterator
+// and with the specified FilterFunc.  The Iterator must be positioned at
+// its first key/value pair, as returned without error by FST.Iterator for
+// example.  If no key/value pair is kept, ErrIteratorDone is returned.
+func NewFilterIterator(itr BasicIterator, f FilterFunc) (*FilterIterator, error) {
+	rv := &FilterIterator{
+		itr: itr,
+		f:   f,
+	}
+	return rv, rv.skip()
+}
+
+// skip moves forward to the first key/value pair the FilterFunc keeps.  The
+// end of the underlying Iterator is only known from the errors it returns,
+// a nil key is a valid (empty) key.
+func (i *FilterIterator) skip() error {
+	for {
+		k, v := i.itr.Current()
+		if i.f(k, v) {
+			return nil
+		}
+		err := i.itr.Next()
+		if err != nil {
+			i.done = true
+			return err
+		}
+	}
+}
+
+// after continues after the underlying Iterator moved with the result err.
+func (i *FilterIterator) after(err error) error {
+	if err != nil {
+		i.done = true
+		return err
+	}
+	i.done = false
+	return i.skip()
+}
+
+// Current returns the key and value currently pointed to by this iterator.
+// If the iterator is done, it returns nil,0.
+func (i *FilterIterator) Current() ([]byte, uint64) {
+	if i.done {
+		return nil, 0
+	}
+	return i.itr.Current()
+}
+
+// Next advances this iterator to the next key/value pair kept.  If there is
+// none, then ErrIteratorDone is returned.
+func (i *FilterIterator) Next() error {
+	if i.done {
+		return ErrIteratorDone
+	}
+	return i.after(i.itr.Next())
+}
+
+// Seek advances this iterator to the first key/value pair kept at or after
+// the specified key.  If there is none, then ErrIteratorDone is returned.
+func (i *FilterIterator) Seek(key []byte) error {
+	return i.after(i.itr.Seek(key))
+}
+
+// Reset resets the underlying Iterator, and moves to the first key/value
+// pair kept.  It returns an error if the underlying iterator does not
+// implement Iterator.
+func (i *FilterIterator) Reset(f *FST, startKeyInclusive, endKeyExclusive []byte,
+	aut Automaton) error {
+	return i.after(reset(i.itr, f, startKeyInclusive, endKeyExclusive, aut))
+}
+
+// Close closes the underlying Iterator.
+func (i *FilterIterator) Close() error {
+	return i.itr.Close()
+}
+
+// MapIterator implements the Iterator interface by traversing another
+// Iterator, rewriting its key/value pairs with a user-provided MapFunc.
+type MapIterator struct {
+	itr  BasicIterator
+	f    MapFunc
+	done bool
+
+	currK []byte
+	currV uint64
+}
+
+// NewMapIterator creates a new MapIterator over the provided Iterator and
+// with the specified MapFunc.  The Iterator must be positioned at its first
+// key/value pair, as returned without error by FST.Iterator for example.
+func NewMapIterator(itr BasicIterator, f MapFunc) (*MapIterator, error) {
+	rv := &MapIterator{
+		itr: itr,
+		f:   f,
+	}
+	return rv, rv.after(nil)
+}
+
+// after updates the current key/value pair after the underlying Iterator
+// moved with the result err.  The end of the underlying Iterator is only
+// known from the errors it returns, a nil key is a valid (empty) key.
+func (i *MapIterator) after(err error) error {
+	if err != nil {
+		i.done = true
+		i.currK, i.currV = nil, 0
+		return err
+	}
+	i.done = false
+	i.currK, i.currV = i.f(i.itr.Current())
+	return nil
+}
+
+// Current returns the key and value currently pointed to by this iterator,
+// as rewritten by the MapFunc.  If the iterator is done, it returns nil,0.
+func (i *MapIterator) Current() ([]byte, uint64) {
+	return i.currK, i.currV
+}
+
+// Next advances this iterator to the next key/value pair.  If there is
+// none, then ErrIteratorDone is returned.
+func (i *MapIterator) Next() error {
+	if i.done {
+		return ErrIteratorDone
+	}
+	return i.after(i.itr.Next())
+}
+
+// Seek advances the underlying Iterator to the specified key, which is a
+// key of the underlying Iterator, not one returned by the MapFunc.  If
+// there is no key after that point, then ErrIteratorDone is returned.
+func (i *MapIterator) Seek(key []byte) error {
+	return i.after(i.itr.Seek(key))
+}
+
+// Reset resets the underlying Iterator.  It returns an error if the
+// underlying iterator does not implement Iterator.
+func (i *MapIterator) Reset(f *FST, startKeyInclusive, endKeyExclusive []byte,
+	aut Automaton) error {
+	return i.after(reset(i.itr, f, startKeyInclusive, endKeyExclusive, aut))
+}
+
+// Close closes the underlying Iterator.
+func (i *MapIterator) Close() error {
+	return i.itr.Close()
+}
+
+// reset resets the provided iterator, if it implements Iterator.
+func reset(itr BasicIterator, f *FST, startKeyInclusive, endKeyExclusive []byte,
+	aut Automaton) error {
+	resettable, ok := itr.(Iterator)
+	if !ok {
+		return fmt.Errorf("iterator %T can not be reset", itr)
+	}
+	return resettable.Reset(f, startKeyInclusive, endKeyExclusive, aut)
+}
@@ -0,0 +1,174 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestFilterIterator(t *testing.T) {
+	in := map[string]uint64{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+	even := func(key []byte, val uint64) bool {
+		return val%2 == 0
+	}
+
+	itr, _ := newTestIterator(in)
+	filtered, err := NewFilterIterator(itr, even)
+	got := collectIterator(t, filtered, err)
+	want := []keyVal{{"b", 2}, {"d", 4}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	err = filtered.Seek([]byte("c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, _ := filtered.Current()
+	if string(k) != "d" {
+		t.Errorf("expected seek to d, got %s", k)
+	}
+	err = filtered.Seek([]byte("e"))
+	if err != ErrIteratorDone {
+		t.Errorf("expected iterator done, got %v", err)
+	}
+
+	itr, _ = newTestIterator(map[string]uint64{"a": 1})
+	_, err = NewFilterIterator(itr, even)
+	if err != ErrIteratorDone {
+		t.Errorf("expected iterator done, got %v", err)
+	}
+}
+
+func TestMapIterator(t *testing.T) {
+	in := map[string]uint64{"a": 1, "b": 2, "c": 3}
+	itr, _ := newTestIterator(in)
+	var key []byte
+	mapped, err := NewMapIterator(itr, func(k []byte, v uint64) ([]byte, uint64) {
+		key = append(append(key[:0], "x/"...), k...)
+		return key, v * 10
+	})
+	got := collectIterator(t, mapped, err)
+	want := []keyVal{{"x/a", 10}, {"x/b", 20}, {"x/c", 30}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// seek uses the keys of the underlying iterator
+	err = mapped.Seek([]byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, v := mapped.Current()
+	if string(k) != "x/b" || v != 20 {
+		t.Errorf("expected x/b 20, got %s %d", k, v)
+	}
+}
+
+func TestFilterMapIteratorBuild(t *testing.T) {
+	itr0, _ := newTestIterator(map[string]uint64{"a": 1, "b": 2, "c": 3})
+	itr1, _ := newTestIterator(map[string]uint64{"b": 4, "d": 5})
+	merged, err := NewMergeIterator([]Iterator{itr0, itr1}, MergeSum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered, err := NewFilterIterator(merged, func(key []byte, val uint64) bool {
+		return !bytes.Equal(key, []byte("c"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := NewMapIterator(filtered, func(key []byte, val uint64) ([]byte, uint64) {
+		return key, val + 100
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	builder, err := New(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for err == nil {
+		k, v := mapped.Current()
+		err = builder.Insert(k, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = mapped.Next()
+	}
+	if err != ErrIteratorDone {
+		t.Fatal(err)
+	}
+	err = builder.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mapped.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fst, err := Load(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	itr, err := fst.Iterator(nil, nil)
+	got := collectIterator(t, itr, err)
+	want := []keyVal{{"a", 101}, {"b", 106}, {"d", 105}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestFilterMapIteratorEmptyKey(t *testing.T) {
+	// the iterator of an FST returns the empty key as a nil slice
+	fst, err := Load(buildTestFST(t, nil, []string{"", "a", "b"}, []uint64{7, 8, 9}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	itr, err := fst.Iterator(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered, err := NewFilterIterator(itr, func(key []byte, val uint64) bool {
+		return val != 8
+	})
+	got := collectIterator(t, filtered, err)
+	want := []keyVal{{"", 7}, {"b", 9}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	itr, err = fst.Iterator(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := NewMapIterator(itr, func(key []byte, val uint64) ([]byte, uint64) {
+		return key, val * 2
+	})
+	got = collectIterator(t, mapped, err)
+	want = []keyVal{{"", 14}, {"a", 16}, {"b", 18}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if k, v := mapped.Current(); k != nil || v != 0 {
+		t.Errorf("expected nil,0 once done, got %q %d", k, v)
+	}
+}
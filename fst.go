@@ -15,7 +15,10 @@
 package vellum
 
 import (
+	"fmt"
 	"io"
+	"sync"
+	"sync/atomic"
 
 	"github.com/willf/bitset"
 )
@@ -24,19 +27,47 @@ import (
 // capable of returning the uint64 value associated with
 // each []byte key stored, as well as enumerating all of the keys
 // in order.
+//
+// An FST is safe for concurrent use by multiple goroutines, Get, Contains,
+// Iterator, Search, and the methods of the iterators returned, may all be
+// called concurrently, and concurrently with Close.  Once Close has been
+// called (and any references acquired have been released) they return
+// ErrClosed.  The Automaton methods (Start, Accept, etc.) and Reader
+// instances are the exception, see their documentation.
 type FST struct {
+	// mu protects data and decoder from being released while they are
+	// read, closing and closed are only set while it is held for writing
+	mu      sync.RWMutex
+	closing bool // Close has been called, no references may be acquired
+	closed  bool // the data has been released
+	refs    int32
+
 	f       io.Closer
 	ver     int
 	len     int
 	typ     int
 	data    []byte
 	decoder decoder
+	meta    map[string][]byte
+
+	// dataStart is the offset of the first byte after the header (and
+	// metadata section), no state may be encoded before it
+	dataStart int
+
+	// counts holds the map[int]uint64 of keys reachable from each state,
+	// once computed by AnnotateCounts
+	counts atomic.Value
 }
 
-func new(data []byte, f io.Closer) (rv *FST, err error) {
+func new(data []byte, f io.Closer, opts *LoadOpts) (rv *FST, err error) {
+	if opts == nil {
+		opts = defaultLoadOpts
+	}
+
 	rv = &FST{
 		data: data,
 		f:    f,
+		refs: 1, // held by the caller, released by Close
 	}
 
 	rv.ver, rv.typ, err = decodeHeader(data)
@@ -44,16 +75,44 @@ func new(data []byte, f io.Closer) (rv *FST, err error) {
 		return nil, err
 	}
 
-	rv.decoder, err = loadDecoder(rv.ver, rv.data)
+	rv.meta, rv.dataStart, err = decodeMetadataSection(data, rv.ver, rv.typ)
+	if err != nil {
+		return nil, err
+	}
+
+	rv.decoder, err = loadDecoder(rv.ver, rv.data, opts.SafeDecode)
 	if err != nil {
 		return nil, err
 	}
 
+	if rv.decoder.getFooterOffset() < rv.dataStart {
+		return nil, truncatedError(len(data),
+			fmt.Sprintf("data too short for footer, %d bytes", len(data)))
+	}
+
+	if opts.SafeDecode {
+		err = rv.checkRoot()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	rv.len = rv.decoder.getLen()
 
 	return rv, nil
 }
 
+// checkRoot ensures the footer describes a root address which lies
+// within the data section.
+func (f *FST) checkRoot() error {
+	end := f.decoder.getFooterOffset()
+	root := f.decoder.getRoot()
+	if root != emptyAddr && (root < f.dataStart || root >= end) {
+		return corruptError(end, fmt.Sprintf("invalid root address %d", root))
+	}
+	return nil
+}
+
 // Contains returns true if this FST contains the specified key.
 func (f *FST) Contains(val []byte) (bool, error) {
 	_, exists, err := f.Get(val)
@@ -62,9 +121,39 @@ func (f *FST) Contains(val []byte) (bool, error) {
 
 // Get returns the value associated with the key.  NOTE: a value of zero
 // does not imply the key does not exist, you must consult the second
-// return value as well.
+// return value as well.  Get does not allocate, the decoded state is
+// taken from a pool shared by all goroutines.
 func (f *FST) Get(input []byte) (uint64, bool, error) {
-	return f.get(input, nil)
+	err := f.rlock()
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.mu.RUnlock()
+
+	state := statePool.Get().(*fstStateV1)
+	val, exists, err := f.get(input, state)
+	state.data = nil // don't keep the data reachable from the pool
+	statePool.Put(state)
+	return val, exists, err
+}
+
+// statePool holds decoded states for Get, so that concurrent lookups do
+// not need to allocate their own, every decoder uses fstStateV1.
+var statePool = sync.Pool{
+	New: func() interface{} {
+		return &fstStateV1{}
+	},
+}
+
+// rlock acquires the read lock, unless the FST has been closed, in which
+// case ErrClosed is returned and the lock is not held.
+func (f *FST) rlock() error {
+	f.mu.RLock()
+	if f.closed {
+		f.mu.RUnlock()
+		return ErrClosed
+	}
+	return nil
 }
 
 func (f *FST) get(input []byte, prealloc fstState) (uint64, bool, error) {
@@ -110,22 +199,98 @@ func (f *FST) Type() int {
 	return f.typ
 }
 
+// Metadata returns the user metadata stored in this FST instance (nil if
+// none was stored).  The values share the underlying FST data, they are
+// only valid until the FST is closed.
+func (f *FST) Metadata() map[string][]byte {
+	return f.meta
+}
+
 // Close will unmap any mmap'd data (if managed by vellum) and it will close
 // the backing file (if managed by vellum).  You MUST call Close() for any
-// FST instance that is created.
+// FST instance that is created.  Close waits for any reads in progress to
+// complete, reads started afterwards return ErrClosed.  If references
+// acquired with Acquire are still held, the FST remains usable and the
+// data is only released by the last call to Release.  Calling Close more
+// than once has no effect.
 func (f *FST) Close() error {
-	if f.f != nil {
-		err := f.f.Close()
-		if err != nil {
-			return err
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closing {
+		return nil
+	}
+	f.closing = true
+	if atomic.AddInt32(&f.refs, -1) > 0 {
+		return nil
+	}
+	return f.release()
+}
+
+// Acquire acquires a reference to the FST, which keeps its data from being
+// released by Close until the reference is released with Release.  Hold a
+// reference for as long as the FST, or any Reader or FSTIterator obtained
+// from it, is in use by code which may race with Close.  Acquire returns
+// ErrClosed if Close has already been called.
+func (f *FST) Acquire() error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.closing {
+		return ErrClosed
+	}
+	atomic.AddInt32(&f.refs, 1)
+	return nil
+}
+
+// Release releases a reference acquired with Acquire.  If Close has been
+// called and this is the last reference, the data is released (unmapping
+// it and closing the backing file, if managed by vellum), and the result
+// of doing so is returned.  Releasing a reference which was not acquired,
+// including once the data has been released, returns an error.
+func (f *FST) Release() error {
+	for {
+		refs := atomic.LoadInt32(&f.refs)
+		if refs <= 1 {
+			break
+		}
+		if atomic.CompareAndSwapInt32(&f.refs, refs, refs-1) {
+			return nil
 		}
 	}
+	// below two, the count is only changed with the lock held (by Close,
+	// Acquire and here), so a release too many can be undone
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	refs := atomic.AddInt32(&f.refs, -1)
+	if refs > 0 {
+		// acquired since the count was read
+		return nil
+	}
+	if refs < 0 || !f.closing {
+		// only Close may release the reference held by the creator
+		atomic.AddInt32(&f.refs, 1)
+		return fmt.Errorf("release of fst without acquire")
+	}
+	// no more references can be acquired, so the count can not change
+	return f.release()
+}
+
+// release releases the data, mu must be held for writing.
+func (f *FST) release() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	var err error
+	if f.f != nil {
+		err = f.f.Close()
+	}
 	f.data = nil
 	f.decoder = nil
-	return nil
+	return err
 }
 
-// Start returns the start state of this Automaton
+// Start returns the start state of this Automaton.  The Automaton methods
+// do no locking, they must not be called concurrently with, or after, Close.
 func (f *FST) Start() int {
 	return f.decoder.getRoot()
 }
@@ -181,19 +346,42 @@ func (f *FST) AcceptWithVal(addr int, b byte) (int, uint64) {
 // Iterator returns a new Iterator capable of enumerating the key/value pairs
 // between the provided startKeyInclusive and endKeyExclusive.
 func (f *FST) Iterator(startKeyInclusive, endKeyExclusive []byte) (*FSTIterator, error) {
-	return newIterator(f, startKeyInclusive, endKeyExclusive, nil)
+	return newIterator(f, startKeyInclusive, endKeyExclusive, nil, nil)
+}
+
+// IteratorWithOpts is like Iterator, using the provided IteratorOpts.
+func (f *FST) IteratorWithOpts(startKeyInclusive, endKeyExclusive []byte,
+	opts *IteratorOpts) (*FSTIterator, error) {
+	return newIterator(f, startKeyInclusive, endKeyExclusive, nil, opts)
 }
 
 // Search returns a new Iterator capable of enumerating the key/value pairs
 // between the provided startKeyInclusive and endKeyExclusive that also
 // satisfy the provided automaton.
 func (f *FST) Search(aut Automaton, startKeyInclusive, endKeyExclusive []byte) (*FSTIterator, error) {
-	return newIterator(f, startKeyInclusive, endKeyExclusive, aut)
+	return newIterator(f, startKeyInclusive, endKeyExclusive, aut, nil)
+}
+
+// SearchWithOpts is like Search, using the provided IteratorOpts.
+func (f *FST) SearchWithOpts(aut Automaton, startKeyInclusive, endKeyExclusive []byte,
+	opts *IteratorOpts) (*FSTIterator, error) {
+	return newIterator(f, startKeyInclusive, endKeyExclusive, aut, opts)
 }
 
 // Debug is only intended for debug purposes, it simply asks the underlying
-// decoder visit each state, and pass it to the provided callback.
-func (f *FST) Debug(callback func(int, interface{}) error) error {
+// decoder visit each state, and pass it to the provided callback.  Like
+// Walk, Debug holds a reference to the FST (see Acquire) for its duration,
+// so the callback may use the FST, and the FST may be closed meanwhile.
+func (f *FST) Debug(callback func(int, interface{}) error) (err error) {
+	err = f.Acquire()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr := f.Release(); err == nil {
+			err = rerr
+		}
+	}()
 
 	addr := f.decoder.getRoot()
 	set := bitset.New(uint(addr))
@@ -244,6 +432,12 @@ func (f *FST) Reader() (*Reader, error) {
 }
 
 func (f *FST) GetMinKey() ([]byte, error) {
+	err := f.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer f.mu.RUnlock()
+
 	var rv []byte
 
 	curr := f.decoder.getRoot()
@@ -252,7 +446,7 @@ func (f *FST) GetMinKey() ([]byte, error) {
 		return nil, err
 	}
 
-	for !state.Final() {
+	for !state.Final() && state.NumTransitions() > 0 {
 		nextTrans := state.TransitionAt(0)
 		_, curr, _ = state.TransitionFor(nextTrans)
 		state, err = f.decoder.stateAt(curr, state)
@@ -267,6 +461,12 @@ func (f *FST) GetMinKey() ([]byte, error) {
 }
 
 func (f *FST) GetMaxKey() ([]byte, error) {
+	err := f.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer f.mu.RUnlock()
+
 	var rv []byte
 
 	curr := f.decoder.getRoot()
@@ -289,12 +489,22 @@ func (f *FST) GetMaxKey() ([]byte, error) {
 	return rv, nil
 }
 
-// A Reader is meant for a single threaded use
+// A Reader is meant for a single threaded use, it reuses one decoded state
+// for all of its lookups.  FST.Get is as efficient and may be shared by
+// goroutines, Reader remains for compatibility.
 type Reader struct {
 	f        *FST
 	prealloc fstStateV1
+	prefixes []PrefixMatch
+	nearest  nearestPath
 }
 
+// Get returns the value associated with the key, like FST.Get.
 func (r *Reader) Get(input []byte) (uint64, bool, error) {
+	err := r.f.rlock()
+	if err != nil {
+		return 0, false, err
+	}
+	defer r.f.mu.RUnlock()
 	return r.f.get(input, &r.prealloc)
 }
@@ -61,12 +61,78 @@ type FSTIterator struct {
 	autStatesStack []int
 
 	nextStart []byte
+
+	// the key and value of the current position, updated by each call
+	// which moves the iterator, so that Current need not read the data
+	currKey []byte
+	currVal uint64
+
+	// when owned keys are requested, the key of the current position is
+	// copied (once) into ownedKey
+	opts       IteratorOpts
+	ownedKey   []byte
+	ownedValid bool
+}
+
+// IteratorOpts is a structure to let advanced users customize the behavior
+// of an FSTIterator.
+type IteratorOpts struct {
+	// OwnedKeys makes Current() return keys which belong to the caller,
+	// remaining valid after the iterator moves, instead of keys which are
+	// only valid until the next call to Next/Seek/Close.
+	OwnedKeys bool
+
+	// KeyArena, if not nil, allocates the owned keys, otherwise each
+	// iterator uses its own.
+	KeyArena *KeyArena
+}
+
+// defaultKeyArenaBlockSize is the size of the blocks allocated by a
+// KeyArena, unless otherwise specified
+const defaultKeyArenaBlockSize = 4096
+
+// A KeyArena allocates copies of keys from large blocks, so that keeping
+// many small keys costs few allocations.  The keys returned remain valid
+// for as long as they are referenced, the arena never reuses memory.  The
+// zero value is ready to use, like an FSTIterator, a KeyArena is meant for
+// single threaded use.
+type KeyArena struct {
+	// BlockSize is the size of the blocks allocated, zero means the
+	// default (4KB).  Keys larger than a quarter of the block size are
+	// allocated individually.
+	BlockSize int
+
+	block []byte
+}
+
+// Copy returns a copy of the key allocated from the arena.  Its capacity is
+// its length, so appending to it never overwrites other keys.
+func (a *KeyArena) Copy(key []byte) []byte {
+	blockSize := a.BlockSize
+	if blockSize <= 0 {
+		blockSize = defaultKeyArenaBlockSize
+	}
+	if len(key) > blockSize/4 {
+		return append([]byte(nil), key...)
+	}
+	if len(key) > cap(a.block)-len(a.block) {
+		a.block = make([]byte, 0, blockSize)
+	}
+	start := len(a.block)
+	a.block = append(a.block, key...)
+	return a.block[start:len(a.block):len(a.block)]
 }
 
 func newIterator(f *FST, startKeyInclusive, endKeyExclusive []byte,
-	aut Automaton) (*FSTIterator, error) {
+	aut Automaton, opts *IteratorOpts) (*FSTIterator, error) {
 
 	rv := &FSTIterator{}
+	if opts != nil {
+		rv.opts = *opts
+	}
+	if rv.opts.OwnedKeys && rv.opts.KeyArena == nil {
+		rv.opts.KeyArena = &KeyArena{}
+	}
 	err := rv.Reset(f, startKeyInclusive, endKeyExclusive, aut)
 	if err != nil {
 		return nil, err
@@ -82,6 +148,27 @@ func (i *FSTIterator) Reset(f *FST,
 		aut = alwaysMatchAutomaton
 	}
 
+	err := f.rlock()
+	if err != nil {
+		return err
+	}
+	defer f.mu.RUnlock()
+	err = i.reset(f, startKeyInclusive, endKeyExclusive, aut)
+	i.updateCurrent()
+	return err
+}
+
+// reset is Reset without locking, the caller must ensure the data of the
+// FST is not released.
+func (i *FSTIterator) reset(f *FST,
+	startKeyInclusive, endKeyExclusive []byte, aut Automaton) error {
+	// nothing can be reused from a previous position
+	i.statesStack = i.statesStack[:0]
+	i.keysStack = i.keysStack[:0]
+	i.keysPosStack = i.keysPosStack[:0]
+	i.valsStack = i.valsStack[:0]
+	i.autStatesStack = i.autStatesStack[:0]
+
 	i.f = f
 	i.startKeyInclusive = startKeyInclusive
 	i.endKeyExclusive = endKeyExclusive
@@ -92,6 +179,16 @@ func (i *FSTIterator) Reset(f *FST,
 
 // pointTo attempts to point us to the specified location
 func (i *FSTIterator) pointTo(key []byte) error {
+	return i.seek(key, false)
+}
+
+// seek points us to the specified location, resuming from the states
+// shared by the key and the current position.  If prune is true, the
+// descent along the key stops as soon as the automaton can no longer
+// match, instead of continuing to the end of the key.
+func (i *FSTIterator) seek(key []byte, prune bool) error {
+	i.ownedValid = false
+
 	// tried to seek before start
 	if bytes.Compare(key, i.startKeyInclusive) < 0 {
 		key = i.startKeyInclusive
@@ -103,25 +200,32 @@ func (i *FSTIterator) pointTo(key []byte) error {
 		key = i.endKeyExclusive
 	}
 
-	// reset any state, pointTo always starts over
-	i.statesStack = i.statesStack[:0]
-	i.keysStack = i.keysStack[:0]
-	i.keysPosStack = i.keysPosStack[:0]
-	i.valsStack = i.valsStack[:0]
-	i.autStatesStack = i.autStatesStack[:0]
+	// the states (and automaton states) along the prefix of the current
+	// key which the key shares are exactly those a descent from the root
+	// would find, so keep them and start over only below them
+	var j int
+	if len(i.statesStack) > 0 {
+		for j < len(i.keysStack) && j < len(key) && i.keysStack[j] == key[j] {
+			j++
+		}
+		i.statesStack = i.statesStack[:j+1]
+		i.keysStack = i.keysStack[:j]
+		i.keysPosStack = i.keysPosStack[:j]
+		i.valsStack = i.valsStack[:j]
+		i.autStatesStack = i.autStatesStack[:j+1]
+	} else {
+		root, err := i.f.decoder.stateAt(i.f.decoder.getRoot(), nil)
+		if err != nil {
+			return err
+		}
 
-	root, err := i.f.decoder.stateAt(i.f.decoder.getRoot(), nil)
-	if err != nil {
-		return err
+		// root is always part of the path
+		i.statesStack = append(i.statesStack, root)
+		i.autStatesStack = append(i.autStatesStack, i.aut.Start())
 	}
 
-	autStart := i.aut.Start()
-
 	maxQ := -1
-	// root is always part of the path
-	i.statesStack = append(i.statesStack, root)
-	i.autStatesStack = append(i.autStatesStack, autStart)
-	for j := 0; j < len(key); j++ {
+	for ; j < len(key); j++ {
 		keyJ := key[j]
 		curr := i.statesStack[len(i.statesStack)-1]
 		autCurr := i.autStatesStack[len(i.autStatesStack)-1]
@@ -139,6 +243,11 @@ func (i *FSTIterator) pointTo(key []byte) error {
 			break
 		}
 		autNext := i.aut.Accept(autCurr, keyJ)
+		if prune && !i.aut.CanMatch(autNext) {
+			// no key beginning with key[:j+1] can match, continue with
+			// the transitions after keyJ
+			return i.next(pos)
+		}
 
 		next, err := i.f.decoder.stateAt(nextAddr, nil)
 		if err != nil {
@@ -150,7 +259,6 @@ func (i *FSTIterator) pointTo(key []byte) error {
 		i.keysPosStack = append(i.keysPosStack, pos)
 		i.valsStack = append(i.valsStack, nextVal)
 		i.autStatesStack = append(i.autStatesStack, autNext)
-		continue
 	}
 
 	if !i.statesStack[len(i.statesStack)-1].Final() ||
@@ -163,9 +271,37 @@ func (i *FSTIterator) pointTo(key []byte) error {
 }
 
 // Current returns the key and value currently pointed to by the iterator.
-// If the iterator is not pointing at a valid value (because Iterator/Next/Seek)
-// returned an error previously, it may return nil,0.
+// Unless the iterator was created with IteratorOpts.OwnedKeys, the key is
+// only valid until the next call to Next/Seek/Close.  If the iterator is
+// not pointing at a valid value (because Iterator/Next/Seek returned an
+// error previously, or the FST has been closed), it may return nil,0.
+//
+// Current does no locking, the key and value are those found by the last
+// call to Reset/Next/Seek.
 func (i *FSTIterator) Current() ([]byte, uint64) {
+	key, val := i.currKey, i.currVal
+	if key != nil && i.opts.OwnedKeys {
+		if !i.ownedValid {
+			i.ownedKey = i.opts.KeyArena.Copy(key)
+			i.ownedValid = true
+		}
+		key = i.ownedKey
+	}
+	return key, val
+}
+
+// updateCurrent records the key and value of the current position for
+// Current, the data of the FST must not have been released.
+func (i *FSTIterator) updateCurrent() {
+	if len(i.statesStack) == 0 {
+		i.currKey, i.currVal = nil, 0
+		return
+	}
+	i.currKey, i.currVal = i.current()
+}
+
+// current is Current without copying the key, reading the data.
+func (i *FSTIterator) current() ([]byte, uint64) {
 	curr := i.statesStack[len(i.statesStack)-1]
 	if curr.Final() {
 		var total uint64
@@ -182,10 +318,19 @@ func (i *FSTIterator) Current() ([]byte, uint64) {
 // or the advancement goes beyond the configured endKeyExclusive, then
 // ErrIteratorDone is returned.
 func (i *FSTIterator) Next() error {
-	return i.next(-1)
+	err := i.f.rlock()
+	if err != nil {
+		return err
+	}
+	defer i.f.mu.RUnlock()
+	err = i.next(-1)
+	i.updateCurrent()
+	return err
 }
 
 func (i *FSTIterator) next(lastOffset int) error {
+	i.ownedValid = false
+
 	// remember where we started with keysStack in this next() call
 	i.nextStart = append(i.nextStart[:0], i.keysStack...)
 
@@ -226,7 +371,7 @@ OUTER:
 				continue INNER
 			}
 
-			pos, nextAddr, v := curr.TransitionFor(t)
+			_, nextAddr, v := curr.TransitionFor(t)
 
 			// the next slot in the statesStack might have an
 			// fstState instance that we can reuse
@@ -243,7 +388,9 @@ OUTER:
 
 			i.statesStack = append(i.statesStack, next)
 			i.keysStack = append(i.keysStack, t)
-			i.keysPosStack = append(i.keysPosStack, pos)
+			// nextOffset is the position of t, unless the data is
+			// corrupt, using it ensures the iteration always progresses
+			i.keysPosStack = append(i.keysPosStack, nextOffset)
 			i.valsStack = append(i.valsStack, v)
 			i.autStatesStack = append(i.autStatesStack, autNext)
 
@@ -291,8 +438,35 @@ OUTER:
 // is not in the FST, Current() will return the next largest key.  If this
 // seek operation would go past the last key, or outside the configured
 // startKeyInclusive/endKeyExclusive then ErrIteratorDone is returned.
+// Only the states below the prefix the key shares with the current
+// position are decoded again.
 func (i *FSTIterator) Seek(key []byte) error {
-	return i.pointTo(key)
+	err := i.f.rlock()
+	if err != nil {
+		return err
+	}
+	defer i.f.mu.RUnlock()
+	err = i.pointTo(key)
+	i.updateCurrent()
+	return err
+}
+
+// SeekNextMatch advances this iterator to the first key/value pair at or
+// after the specified key which the automaton matches, like Seek.  Unlike
+// Seek, it stops following the key as soon as the automaton reports (with
+// CanMatch) that no key with the prefix followed so far can match, and
+// moves directly on to the keys after that prefix.  This makes repeatedly
+// seeking an iterator to keys chosen by another source, as intersections
+// do, cheaper when many of those keys are rejected by the automaton.
+func (i *FSTIterator) SeekNextMatch(key []byte) error {
+	err := i.f.rlock()
+	if err != nil {
+		return err
+	}
+	defer i.f.mu.RUnlock()
+	err = i.seek(key, true)
+	i.updateCurrent()
+	return err
 }
 
 // Close will free any resources held by this iterator.
@@ -16,6 +16,7 @@ package vellum
 
 import (
 	"bytes"
+	"math/rand"
 	"reflect"
 	"testing"
 
@@ -694,3 +695,267 @@ func TestIssue32(t *testing.T) {
 		t.Errorf("iterator error: %v", err)
 	}
 }
+
+func TestIteratorOwnedKeys(t *testing.T) {
+	fst, vals, cleanup := openTestFST(t)
+	defer cleanup()
+
+	for _, opts := range []*IteratorOpts{
+		{OwnedKeys: true},
+		{OwnedKeys: true, KeyArena: &KeyArena{BlockSize: 64}},
+	} {
+		// keep the keys without copying them
+		var keys [][]byte
+		itr, err := fst.IteratorWithOpts(nil, nil, opts)
+		for err == nil {
+			key, val := itr.Current()
+			again, _ := itr.Current()
+			if &key[0] != &again[0] {
+				t.Fatalf("expected the same key from repeated calls to Current")
+			}
+			if val != vals[len(keys)] {
+				t.Fatalf("expected %d, got %d", vals[len(keys)], val)
+			}
+			keys = append(keys, key)
+			err = itr.Next()
+		}
+		if err != ErrIteratorDone {
+			t.Fatalf("error iterating: %v", err)
+		}
+		if len(keys) != len(thousandTestWords) {
+			t.Fatalf("expected %d keys, got %d", len(thousandTestWords), len(keys))
+		}
+		for i, key := range keys {
+			if string(key) != thousandTestWords[i] {
+				t.Errorf("expected %q, got %q", thousandTestWords[i], key)
+			}
+		}
+	}
+}
+
+func TestKeyArena(t *testing.T) {
+	a := &KeyArena{BlockSize: 16}
+	first := a.Copy([]byte("abc"))
+	second := a.Copy([]byte("def"))
+	if cap(first) != 3 {
+		t.Errorf("expected capacity 3, got %d", cap(first))
+	}
+	_ = append(first, 'x')
+	if string(second) != "def" {
+		t.Errorf("appending to a key overwrote the next, got %q", second)
+	}
+	large := a.Copy([]byte("0123456789"))
+	if string(large) != "0123456789" {
+		t.Errorf("expected large key copied, got %q", large)
+	}
+	if string(a.Copy(nil)) != "" {
+		t.Errorf("expected empty key")
+	}
+}
+
+func BenchmarkIteratorCopyKeys(b *testing.B) {
+	fst, _, cleanup := openTestFST(b)
+	defer cleanup()
+
+	keys := make([][]byte, 0, len(thousandTestWords))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		keys = keys[:0]
+		itr, err := fst.Iterator(nil, nil)
+		for err == nil {
+			key, _ := itr.Current()
+			keys = append(keys, append([]byte(nil), key...))
+			err = itr.Next()
+		}
+	}
+}
+
+func BenchmarkIteratorOwnedKeys(b *testing.B) {
+	fst, _, cleanup := openTestFST(b)
+	defer cleanup()
+
+	keys := make([][]byte, 0, len(thousandTestWords))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		keys = keys[:0]
+		itr, err := fst.IteratorWithOpts(nil, nil, &IteratorOpts{OwnedKeys: true})
+		for err == nil {
+			key, _ := itr.Current()
+			keys = append(keys, key)
+			err = itr.Next()
+		}
+	}
+}
+
+// countingAutomaton counts the calls to Accept of the wrapped automaton
+type countingAutomaton struct {
+	Automaton
+	accepts int
+}
+
+func (a *countingAutomaton) Accept(s int, b byte) int {
+	a.accepts++
+	return a.Automaton.Accept(s, b)
+}
+
+func TestSeekResume(t *testing.T) {
+	fst, _, cleanup := openTestFST(t)
+	defer cleanup()
+
+	re, err := regexp.New("[a-m].*e[rs]")
+	if err != nil {
+		t.Fatalf("error compiling regexp: %v", err)
+	}
+	lb, err := levenshtein.NewLevenshteinAutomatonBuilder(uint8(2), false)
+	if err != nil {
+		t.Fatalf("error creating levenshtein builder: %v", err)
+	}
+	fuzzy, err := lb.BuildDfa("there", 2)
+	if err != nil {
+		t.Fatalf("error building levenshtein automaton: %v", err)
+	}
+
+	// seek keys in random order, near, before and after the test words
+	r := rand.New(rand.NewSource(1))
+	var seeks [][]byte
+	for n := 0; n < 500; n++ {
+		word := []byte(thousandTestWords[r.Intn(len(thousandTestWords))])
+		switch n % 4 {
+		case 0:
+			seeks = append(seeks, word)
+		case 1:
+			seeks = append(seeks, word[:r.Intn(len(word)+1)])
+		case 2:
+			seeks = append(seeks, append(word, 'z'))
+		case 3:
+			word[len(word)-1]++
+			seeks = append(seeks, word)
+		}
+	}
+
+	for _, aut := range []Automaton{nil, re, fuzzy} {
+		for _, end := range [][]byte{nil, []byte("m")} {
+			itr, err := fst.Search(aut, nil, end)
+			if err != nil {
+				t.Fatalf("error creating iterator: %v", err)
+			}
+			for n, seek := range seeks {
+				seekNextMatch := n%2 == 1
+				if seekNextMatch {
+					err = itr.SeekNextMatch(seek)
+				} else {
+					err = itr.Seek(seek)
+				}
+				key, val := itr.Current()
+
+				// compare with a new iterator starting at the key
+				fresh, ferr := fst.Search(aut, seek, end)
+				if err != ferr {
+					t.Fatalf("seek %q (next match %t): expected %v, got %v",
+						seek, seekNextMatch, ferr, err)
+				}
+				if err != nil {
+					continue
+				}
+				expectedKey, expectedVal := fresh.Current()
+				if !bytes.Equal(key, expectedKey) || val != expectedVal {
+					t.Fatalf("seek %q (next match %t): expected %q %d, got %q %d",
+						seek, seekNextMatch, expectedKey, expectedVal, key, val)
+				}
+
+				// and that the iterator continues correctly
+				err = itr.Next()
+				ferr = fresh.Next()
+				if err != ferr {
+					t.Fatalf("next after seek %q: expected %v, got %v", seek, ferr, err)
+				}
+				if err == nil {
+					key, val = itr.Current()
+					expectedKey, expectedVal = fresh.Current()
+					if !bytes.Equal(key, expectedKey) || val != expectedVal {
+						t.Fatalf("next after seek %q: expected %q %d, got %q %d",
+							seek, expectedKey, expectedVal, key, val)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSeekNextMatchPrunes(t *testing.T) {
+	fst, _, cleanup := openTestFST(t)
+	defer cleanup()
+
+	re, err := regexp.New("y.*")
+	if err != nil {
+		t.Fatalf("error compiling regexp: %v", err)
+	}
+
+	// seeking to a long key which the automaton rejects from its first
+	// byte, only SeekNextMatch stops following it immediately
+	seek := []byte(thousandTestWords[0] + "aaaaaaaaaaaaaaaaaaaaaaaaaa")
+	accepts := map[bool]int{}
+	for _, seekNextMatch := range []bool{false, true} {
+		aut := &countingAutomaton{Automaton: re}
+		itr, err := fst.Search(aut, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating iterator: %v", err)
+		}
+		aut.accepts = 0
+		if seekNextMatch {
+			err = itr.SeekNextMatch(seek)
+		} else {
+			err = itr.Seek(seek)
+		}
+		if err != nil {
+			t.Fatalf("error seeking: %v", err)
+		}
+		key, _ := itr.Current()
+		if key[0] != 'y' {
+			t.Errorf("expected key starting with y, got %q", key)
+		}
+		accepts[seekNextMatch] = aut.accepts
+	}
+	if accepts[true] >= accepts[false] {
+		t.Errorf("expected SeekNextMatch to call Accept less than Seek, got %d and %d",
+			accepts[true], accepts[false])
+	}
+}
+
+func benchmarkSeek(b *testing.B, seekNextMatch bool) {
+	fst, _, cleanup := openTestFST(b)
+	defer cleanup()
+	re, err := regexp.New("[a-c].*ing")
+	if err != nil {
+		b.Fatalf("error compiling regexp: %v", err)
+	}
+	itr, err := fst.Search(re, nil, nil)
+	if err != nil {
+		b.Fatalf("error creating iterator: %v", err)
+	}
+	seeks := make([][]byte, len(thousandTestWords))
+	for i, word := range thousandTestWords {
+		seeks[i] = []byte(word)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, seek := range seeks {
+			if seekNextMatch {
+				_ = itr.SeekNextMatch(seek)
+			} else {
+				_ = itr.Seek(seek)
+			}
+		}
+	}
+}
+
+func BenchmarkSeek(b *testing.B) {
+	benchmarkSeek(b, false)
+}
+
+func BenchmarkSeekNextMatch(b *testing.B) {
+	benchmarkSeek(b, true)
+}
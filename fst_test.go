@@ -0,0 +1,338 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+// openTestFST writes the thousand test words to a temporary file and opens
+// it, so that the data is mmap'd where supported.
+func openTestFST(t testing.TB) (*FST, []uint64, func()) {
+	vals := randomValues(thousandTestWords)
+	data := buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}, thousandTestWords, vals)
+	f, err := ioutil.TempFile("", "vellum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst, err := Open(f.Name())
+	if err != nil {
+		t.Fatalf("error opening: %v", err)
+	}
+	return fst, vals, func() {
+		_ = fst.Close()
+		_ = os.Remove(f.Name())
+	}
+}
+
+func TestGetNoAllocs(t *testing.T) {
+	fst, _, cleanup := openTestFST(t)
+	defer cleanup()
+
+	key := []byte(thousandTestWords[500])
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _, _ = fst.Get(key)
+	})
+	if allocs != 0 {
+		t.Errorf("expected Get not to allocate, got %f allocs", allocs)
+	}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	fst, vals, cleanup := openTestFST(t)
+	defer cleanup()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for g := 0; g < 8; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < len(thousandTestWords); i += 8 {
+				val, exists, err := fst.Get([]byte(thousandTestWords[i]))
+				if err != nil || !exists || val != vals[i] {
+					t.Errorf("expected %q -> %d, got %d %t %v",
+						thousandTestWords[i], vals[i], val, exists, err)
+					return
+				}
+			}
+		}(g)
+		go func() {
+			defer wg.Done()
+			var n int
+			itr, err := fst.Iterator(nil, nil)
+			for err == nil {
+				_, val := itr.Current()
+				if val != vals[n] {
+					t.Errorf("expected %d at %d, got %d", vals[n], n, val)
+					return
+				}
+				n++
+				err = itr.Next()
+			}
+			if err != ErrIteratorDone {
+				errs <- err
+			} else if n != len(thousandTestWords) {
+				t.Errorf("expected %d keys, iterated %d", len(thousandTestWords), n)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("unexpected error iterating: %v", err)
+	}
+}
+
+func TestConcurrentClose(t *testing.T) {
+	fst, vals, cleanup := openTestFST(t)
+	defer cleanup()
+
+	// each reader keeps going until it sees the FST closed, start the
+	// iterators before closing so that some are open across the Close
+	var wg sync.WaitGroup
+	started := make(chan struct{}, 8)
+	for g := 0; g < 4; g++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			reader, _ := fst.Reader()
+			started <- struct{}{}
+			for i := 0; ; i = (i + 1) % len(thousandTestWords) {
+				key := []byte(thousandTestWords[i])
+				val, exists, err := fst.Get(key)
+				if err == ErrClosed {
+					break
+				}
+				if err != nil || !exists || val != vals[i] {
+					t.Errorf("expected %q -> %d, got %d %t %v",
+						key, vals[i], val, exists, err)
+					return
+				}
+				_, _, err = reader.Get(key)
+				if err != nil && err != ErrClosed {
+					t.Errorf("unexpected reader error: %v", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			started <- struct{}{}
+			for {
+				itr, err := fst.Iterator(nil, nil)
+				for err == nil {
+					itr.Current()
+					err = itr.Next()
+				}
+				if err == ErrClosed {
+					return
+				}
+				if err != ErrIteratorDone {
+					t.Errorf("unexpected error iterating: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	for g := 0; g < 8; g++ {
+		<-started
+	}
+
+	err := fst.Close()
+	if err != nil {
+		t.Fatalf("error closing: %v", err)
+	}
+	wg.Wait()
+
+	_, _, err = fst.Get([]byte(thousandTestWords[0]))
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed after close, got %v", err)
+	}
+	_, err = fst.Iterator(nil, nil)
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed after close, got %v", err)
+	}
+	err = fst.Close()
+	if err != nil {
+		t.Errorf("expected second close to succeed, got %v", err)
+	}
+}
+
+func TestAcquireRelease(t *testing.T) {
+	fst, vals, cleanup := openTestFST(t)
+	defer cleanup()
+
+	err := fst.Release()
+	if err == nil {
+		t.Errorf("expected error releasing without acquire")
+	}
+
+	err = fst.Acquire()
+	if err != nil {
+		t.Fatalf("error acquiring: %v", err)
+	}
+	itr, err := fst.Iterator(nil, nil)
+	if err != nil {
+		t.Fatalf("error creating iterator: %v", err)
+	}
+
+	// the reference keeps the data from being released by Close
+	err = fst.Close()
+	if err != nil {
+		t.Fatalf("error closing: %v", err)
+	}
+	err = fst.Acquire()
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed acquiring after close, got %v", err)
+	}
+	var n int
+	for err = nil; err == nil; err = itr.Next() {
+		_, val := itr.Current()
+		if val != vals[n] {
+			t.Fatalf("expected %d at %d, got %d", vals[n], n, val)
+		}
+		n++
+	}
+	if err != ErrIteratorDone || n != len(thousandTestWords) {
+		t.Errorf("expected %d keys, got %d %v", len(thousandTestWords), n, err)
+	}
+	val, exists, err := fst.Get([]byte(thousandTestWords[0]))
+	if err != nil || !exists || val != vals[0] {
+		t.Errorf("expected %d, got %d %t %v", vals[0], val, exists, err)
+	}
+
+	// releasing the last reference releases the data
+	err = fst.Release()
+	if err != nil {
+		t.Fatalf("error releasing: %v", err)
+	}
+	_, _, err = fst.Get([]byte(thousandTestWords[0]))
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed after release, got %v", err)
+	}
+	err = itr.Next()
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed from iterator after release, got %v", err)
+	}
+}
+
+func TestReleaseAfterClose(t *testing.T) {
+	fst, vals, cleanup := openTestFST(t)
+	defer cleanup()
+
+	err := fst.Acquire()
+	if err != nil {
+		t.Fatalf("error acquiring: %v", err)
+	}
+	err = fst.Acquire()
+	if err != nil {
+		t.Fatalf("error acquiring: %v", err)
+	}
+	err = fst.Close()
+	if err != nil {
+		t.Fatalf("error closing: %v", err)
+	}
+
+	// the data is released by the last reference, any release after
+	// that fails instead of taking the count below zero
+	err = fst.Release()
+	if err != nil {
+		t.Fatalf("error releasing: %v", err)
+	}
+	val, exists, err := fst.Get([]byte(thousandTestWords[0]))
+	if err != nil || !exists || val != vals[0] {
+		t.Errorf("expected %d, got %d %t %v", vals[0], val, exists, err)
+	}
+	err = fst.Release()
+	if err != nil {
+		t.Fatalf("error releasing: %v", err)
+	}
+	err = fst.Release()
+	if err == nil {
+		t.Errorf("expected error releasing after the data was released")
+	}
+	err = fst.Release()
+	if err == nil {
+		t.Errorf("expected error releasing after the data was released")
+	}
+	err = fst.Acquire()
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed acquiring after release, got %v", err)
+	}
+	_, _, err = fst.Get([]byte(thousandTestWords[0]))
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed after release, got %v", err)
+	}
+}
+
+func TestDebugClose(t *testing.T) {
+	fst, vals, cleanup := openTestFST(t)
+	defer cleanup()
+
+	// the callback may use the FST, and close it, without deadlocking
+	var n int
+	err := fst.Debug(func(int, interface{}) error {
+		if n == 0 {
+			err := fst.Close()
+			if err != nil {
+				return err
+			}
+		}
+		val, exists, err := fst.Get([]byte(thousandTestWords[n%len(thousandTestWords)]))
+		if err != nil || !exists || val != vals[n%len(vals)] {
+			t.Fatalf("expected %d, got %d %t %v", vals[n%len(vals)], val, exists, err)
+		}
+		n++
+		return nil
+	})
+	if err != nil || n == 0 {
+		t.Fatalf("expected debug of all states, got %d %v", n, err)
+	}
+	_, _, err = fst.Get([]byte(thousandTestWords[0]))
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed after debug, got %v", err)
+	}
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	fst, _, cleanup := openTestFST(b)
+	defer cleanup()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			_, _, _ = fst.Get([]byte(thousandTestWords[i%len(thousandTestWords)]))
+			i++
+		}
+	})
+}
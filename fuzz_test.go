@@ -0,0 +1,148 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// exerciseSafeFST loads the data in safe decode mode and then exercises
+// the read paths, it should never panic regardless of the input.
+func exerciseSafeFST(data []byte) {
+	fst, err := LoadWithOpts(data, &LoadOpts{SafeDecode: true})
+	if err != nil {
+		return
+	}
+	for _, key := range []string{"", "a", "mon", "tues", "thurs", "tye"} {
+		_, _, _ = fst.Get([]byte(key))
+	}
+	_, _ = fst.GetMinKey()
+	_, _ = fst.GetMaxKey()
+	_ = fst.Verify()
+
+	// corrupt data may describe a very large number of keys, so
+	// only visit a bounded number of them
+	itr, err := fst.Iterator(nil, nil)
+	for i := 0; err == nil && i < 1000; i++ {
+		_, _ = itr.Current()
+		err = itr.Next()
+	}
+	itr, err = fst.Iterator([]byte("b"), []byte("t"))
+	for i := 0; err == nil && i < 1000; i++ {
+		err = itr.Seek([]byte("m"))
+		if err == nil {
+			err = itr.Next()
+		}
+	}
+}
+
+func fuzzSeeds(t testing.TB) [][]byte {
+	metaOpts := &BuilderOpts{
+		Encoder:           versionV2,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+		Metadata:          map[string][]byte{"creator": []byte("fuzz")},
+	}
+	var keys []string
+	for k := range smallSample {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var vals []uint64
+	for _, k := range keys {
+		vals = append(vals, smallSample[k])
+	}
+	// states with enough transitions for the v3 index and v4 bitmap
+	var denseKeys []string
+	for i := 0; i < 40; i++ {
+		denseKeys = append(denseKeys, string([]byte{'a', byte(3 * i)}))
+	}
+	denseOpts := func(ver int) *BuilderOpts {
+		return &BuilderOpts{
+			Encoder:           ver,
+			RegistryTableSize: 10000,
+			RegistryMRUSize:   2,
+		}
+	}
+	return [][]byte{
+		buildTestFST(t, nil, keys, vals),
+		buildTestFST(t, denseOpts(versionV3), denseKeys, randomValues(denseKeys)),
+		buildTestFST(t, denseOpts(versionV4), denseKeys, randomValues(denseKeys)),
+		buildTestFST(t, metaOpts, keys, vals),
+		buildTestFST(t, nil, []string{}, nil),
+		buildTestFST(t, nil, []string{""}, []uint64{7}),
+		buildTestFST(t, nil, thousandTestWords[:100], randomValues(thousandTestWords[:100])),
+	}
+}
+
+// TestSafeDecodeMutations deterministically mutates valid FSTs, by
+// truncating them, and changing single bytes, ensuring that safe decode
+// mode never panics.
+func TestSafeDecodeMutations(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, seed := range fuzzSeeds(t) {
+		for i := 0; i <= len(seed); i++ {
+			exerciseSafeFST(seed[:i])
+			exerciseSafeFST(seed[i:])
+		}
+		for i := 0; i < len(seed); i++ {
+			for _, b := range []byte{0, 1, 0x0f, 0x40, 0x80, 0xc0, 0xff, byte(rng.Intn(256))} {
+				mutated := append([]byte(nil), seed...)
+				mutated[i] = b
+				exerciseSafeFST(mutated)
+			}
+		}
+	}
+}
+
+func TestSafeDecodeInvalidFooter(t *testing.T) {
+	data := buildTestFST(t, nil, []string{"a", "b"}, []uint64{1, 2})
+	data[len(data)-8] = 0xff // root address past end of data
+	_, err := LoadWithOpts(data, &LoadOpts{SafeDecode: true})
+	if _, ok := err.(*CorruptError); !ok {
+		t.Errorf("expected corrupt error, got %v", err)
+	}
+	_, err = LoadWithOpts(data[:headerSize+4], &LoadOpts{SafeDecode: true})
+	if _, ok := err.(*CorruptError); !ok {
+		t.Errorf("expected corrupt error, got %v", err)
+	}
+}
+
+func TestSafeDecodeInvalidDest(t *testing.T) {
+	data := []byte{
+		// header
+		1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		// root, its transition delta points before the start of the data
+		0xff,     // delta address packed
+		1<<4 | 0, // pack sizes
+		oneTransition | encodeCommon('a'),
+		// footer
+		1, 0, 0, 0, 0, 0, 0, 0, 18, 0, 0, 0, 0, 0, 0, 0,
+	}
+	fst, err := LoadWithOpts(data, &LoadOpts{SafeDecode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, exists, err := fst.Get([]byte("a"))
+	if err != nil || exists {
+		t.Errorf("expected invalid transition to be ignored, got %t %v", exists, err)
+	}
+	_, err = fst.Iterator(nil, nil)
+	if err != ErrIteratorDone {
+		t.Errorf("expected iterator done, got %v", err)
+	}
+}
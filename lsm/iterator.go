@@ -0,0 +1,149 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsm
+
+import (
+	"github.com/couchbase/vellum"
+)
+
+// Iterator enumerates the keys of a Dictionary in lexicographic order, as
+// they were when it was created, skipping deleted keys.  It remains usable
+// while the Dictionary changes, is compacted or closed, until it is closed
+// itself.
+type Iterator struct {
+	itr  *vellum.MergeIterator
+	fsts []*vellum.FST
+}
+
+// Iterator returns an Iterator over the keys from startKeyInclusive to
+// endKeyExclusive (nil meaning unbounded).  Like FST.Iterator, it returns
+// vellum.ErrIteratorDone if there are none.
+func (d *Dictionary) Iterator(startKeyInclusive,
+	endKeyExclusive []byte) (*Iterator, error) {
+	return d.Search(nil, startKeyInclusive, endKeyExclusive)
+}
+
+// Search returns an Iterator over the keys from startKeyInclusive to
+// endKeyExclusive which the provided Automaton matches.  A nil Automaton
+// matches every key.
+func (d *Dictionary) Search(aut vellum.Automaton, startKeyInclusive,
+	endKeyExclusive []byte) (*Iterator, error) {
+	d.m.RLock()
+	defer d.m.RUnlock()
+	if d.closed {
+		return nil, vellum.ErrClosed
+	}
+
+	rv := &Iterator{}
+	var itrs []vellum.Iterator
+	memItr, err := newMemIterator(d.mem.sorted(), aut,
+		startKeyInclusive, endKeyExclusive)
+	if err == nil {
+		itrs = append(itrs, memItr)
+	} else if err != vellum.ErrIteratorDone {
+		return nil, err
+	}
+	for _, s := range d.segments {
+		var itr *vellum.FSTIterator
+		if aut == nil {
+			itr, err = s.fst.Iterator(startKeyInclusive, endKeyExclusive)
+		} else {
+			itr, err = s.fst.Search(aut, startKeyInclusive, endKeyExclusive)
+		}
+		if err == vellum.ErrIteratorDone {
+			continue
+		}
+		if err == nil {
+			// keep the FST open as long as the iterator, the
+			// Dictionary may close it after a compaction
+			err = s.fst.Acquire()
+		}
+		if err != nil {
+			_ = rv.Close()
+			return nil, err
+		}
+		rv.fsts = append(rv.fsts, s.fst)
+		itrs = append(itrs, itr)
+	}
+	if len(itrs) == 0 {
+		return nil, vellum.ErrIteratorDone
+	}
+
+	rv.itr, err = vellum.NewMergeIterator(itrs, mergeNewest)
+	if err == nil {
+		err = rv.skipDeleted()
+	}
+	if err != nil {
+		_ = rv.Close()
+		return nil, err
+	}
+	return rv, nil
+}
+
+// Current returns the key and value currently pointed to by the iterator.
+func (i *Iterator) Current() ([]byte, uint64) {
+	return i.itr.Current()
+}
+
+// Next advances the iterator to the next key, returning
+// vellum.ErrIteratorDone if there is none.
+func (i *Iterator) Next() error {
+	err := i.itr.Next()
+	if err != nil {
+		return err
+	}
+	return i.skipDeleted()
+}
+
+// Seek advances the iterator to the specified key, or the next key if it
+// does not exist, returning vellum.ErrIteratorDone if there is none.
+func (i *Iterator) Seek(key []byte) error {
+	err := i.itr.Seek(key)
+	if err != nil {
+		return err
+	}
+	return i.skipDeleted()
+}
+
+// skipDeleted moves forward past any keys deleted.
+func (i *Iterator) skipDeleted() error {
+	for {
+		_, val := i.itr.Current()
+		if val != Tombstone {
+			return nil
+		}
+		err := i.itr.Next()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the iterator, releasing the segments it was using.
+func (i *Iterator) Close() error {
+	var rv error
+	if i.itr != nil {
+		rv = i.itr.Close()
+		i.itr = nil
+	}
+	for _, fst := range i.fsts {
+		err := fst.Release()
+		if rv == nil {
+			rv = err
+		}
+	}
+	i.fsts = nil
+	return rv
+}
@@ -0,0 +1,435 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package lsm maintains an updatable dictionary of keys and uint64 values on
+top of immutable vellum FSTs, in the style of a log structured merge tree.
+
+Writes (and deletes, recorded as a Tombstone value) go to an in-memory
+memtable.  When it fills up, it is flushed to a new immutable FST segment.
+Reads consult the memtable and then the segments from newest to oldest, and
+iterators merge all of them with a vellum.MergeIterator, the newest value of
+each key winning.  When there are too many segments, they are compacted
+into one in the background with vellum.MergeWithDelete, which drops the
+deleted keys.
+*/
+package lsm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/couchbase/vellum"
+)
+
+// Tombstone is the value recording that a key has been deleted, it can not
+// be stored with Set.
+const Tombstone = math.MaxUint64
+
+const defaultMemtableSize = 64 * 1024
+const defaultMaxSegments = 8
+
+// Options is a structure to let users customize the behavior of a
+// Dictionary.
+type Options struct {
+	// Dir is the directory in which segments are stored, and from which
+	// existing segments are loaded, it is created if needed.  Empty means
+	// the segments are only kept in memory.
+	Dir string
+
+	// MemtableSize is the number of keys written to the memtable before
+	// it is flushed to a segment, zero means the default (64K).
+	MemtableSize int
+
+	// MaxSegments is the number of segments above which they are all
+	// compacted into one, zero means the default (8).
+	MaxSegments int
+
+	// BuilderOpts are used to build the segments.
+	BuilderOpts *vellum.BuilderOpts
+}
+
+// segment is an immutable FST holding the writes flushed from one or more
+// memtables, those numbered from minID to maxID.
+type segment struct {
+	minID int
+	maxID int
+	fst   *vellum.FST
+	path  string // empty if only in memory
+}
+
+// Dictionary is an updatable dictionary of keys and uint64 values, it is
+// safe for concurrent use by multiple goroutines.
+type Dictionary struct {
+	opts Options
+
+	m        sync.RWMutex
+	mem      *memtable
+	segments []*segment // newest first
+	nextID   int
+	closed   bool
+	err      error // the first error of a background compaction
+
+	// compactM serializes compactions, and Close with them
+	compactM   sync.Mutex
+	compacting bool // a background compaction has been started
+}
+
+// Open returns a Dictionary using the provided Options, loading any
+// segments previously stored in opts.Dir.  Writes which were not flushed
+// (by Flush or Close) are not stored.
+func Open(opts *Options) (*Dictionary, error) {
+	rv := &Dictionary{
+		mem: newMemtable(),
+	}
+	if opts != nil {
+		rv.opts = *opts
+	}
+	if rv.opts.MemtableSize <= 0 {
+		rv.opts.MemtableSize = defaultMemtableSize
+	}
+	if rv.opts.MaxSegments <= 0 {
+		rv.opts.MaxSegments = defaultMaxSegments
+	}
+	if rv.opts.Dir != "" {
+		err := rv.loadSegments()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rv, nil
+}
+
+// loadSegments opens the segments stored in the directory.  A segment
+// whose writes are all included in a compacted segment was left behind by
+// an interrupted compaction, it is removed.
+func (d *Dictionary) loadSegments() error {
+	err := os.MkdirAll(d.opts.Dir, 0700)
+	if err != nil {
+		return err
+	}
+	names, err := filepath.Glob(filepath.Join(d.opts.Dir, "segment-*"))
+	if err != nil {
+		return err
+	}
+	var segments []*segment
+	for _, name := range names {
+		var minID, maxID int
+		_, err = fmt.Sscanf(filepath.Base(name), "segment-%08d-%08d.fst", &minID, &maxID)
+		if err != nil || filepath.Ext(name) != ".fst" {
+			// not written completely
+			_ = os.Remove(name)
+			continue
+		}
+		segments = append(segments, &segment{minID: minID, maxID: maxID, path: name})
+	}
+
+	// newest first, and for equal newest, those covering the most first
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].maxID != segments[j].maxID {
+			return segments[i].maxID > segments[j].maxID
+		}
+		return segments[i].minID < segments[j].minID
+	})
+	for _, s := range segments {
+		if len(d.segments) > 0 && s.maxID >= d.segments[len(d.segments)-1].minID {
+			err = os.Remove(s.path)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		s.fst, err = vellum.Open(s.path)
+		if err != nil {
+			d.closeSegments(d.segments)
+			return err
+		}
+		d.segments = append(d.segments, s)
+	}
+	if len(d.segments) > 0 {
+		d.nextID = d.segments[0].maxID + 1
+	}
+	return nil
+}
+
+// Set associates the value with the key, replacing any previous value.
+func (d *Dictionary) Set(key []byte, val uint64) error {
+	if val == Tombstone {
+		return fmt.Errorf("value %d is reserved for deletes", val)
+	}
+	return d.set(key, val)
+}
+
+// Delete removes the key, if it exists.
+func (d *Dictionary) Delete(key []byte) error {
+	return d.set(key, Tombstone)
+}
+
+func (d *Dictionary) set(key []byte, val uint64) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+	if d.closed {
+		return vellum.ErrClosed
+	}
+	d.mem.set(key, val)
+	if d.mem.len() >= d.opts.MemtableSize {
+		return d.flushLocked(true)
+	}
+	return nil
+}
+
+// Get returns the value associated with the key, and whether or not the
+// key exists.
+func (d *Dictionary) Get(key []byte) (uint64, bool, error) {
+	d.m.RLock()
+	defer d.m.RUnlock()
+	if d.closed {
+		return 0, false, vellum.ErrClosed
+	}
+	val, exists := d.mem.get(key)
+	for _, s := range d.segments {
+		if exists {
+			break
+		}
+		var err error
+		val, exists, err = s.fst.Get(key)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	if !exists || val == Tombstone {
+		return 0, false, nil
+	}
+	return val, true, nil
+}
+
+// Flush writes the memtable to a new segment.
+func (d *Dictionary) Flush() error {
+	d.m.Lock()
+	defer d.m.Unlock()
+	if d.closed {
+		return vellum.ErrClosed
+	}
+	return d.flushLocked(true)
+}
+
+// flushLocked writes the memtable to a new segment, and if there are now
+// too many segments, and compact is true, starts compacting them in the
+// background.  The write lock must be held.
+func (d *Dictionary) flushLocked(compact bool) error {
+	if d.mem.len() == 0 {
+		return nil
+	}
+	entries := d.mem.sorted()
+	id := d.nextID
+	s, err := d.writeSegment(id, id, func(w io.Writer) error {
+		builder, err := vellum.New(w, d.opts.BuilderOpts)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			err = builder.Insert(entry.key, entry.val)
+			if err != nil {
+				return err
+			}
+		}
+		return builder.Close()
+	})
+	if err != nil {
+		return err
+	}
+	d.nextID++
+	d.segments = append([]*segment{s}, d.segments...)
+	d.mem = newMemtable()
+
+	if compact && !d.compacting && len(d.segments) > d.opts.MaxSegments {
+		d.compacting = true
+		go func() {
+			err := d.compact()
+			d.m.Lock()
+			if d.err == nil && err != vellum.ErrClosed {
+				d.err = err
+			}
+			d.compacting = false
+			d.m.Unlock()
+		}()
+	}
+	return nil
+}
+
+// writeSegment writes a segment, either to memory or to a file in the
+// directory, which only receives its final name once complete.
+func (d *Dictionary) writeSegment(minID, maxID int,
+	write func(io.Writer) error) (*segment, error) {
+	rv := &segment{minID: minID, maxID: maxID}
+	if d.opts.Dir == "" {
+		var buf bytes.Buffer
+		err := write(&buf)
+		if err != nil {
+			return nil, err
+		}
+		rv.fst, err = vellum.Load(buf.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		return rv, nil
+	}
+
+	rv.path = filepath.Join(d.opts.Dir,
+		fmt.Sprintf("segment-%08d-%08d.fst", minID, maxID))
+	f, err := ioutil.TempFile(d.opts.Dir, "segment-tmp-")
+	if err != nil {
+		return nil, err
+	}
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), rv.path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	rv.fst, err = vellum.Open(rv.path)
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// Compact merges all of the segments into one, waiting for any compaction
+// running in the background to complete first.
+func (d *Dictionary) Compact() error {
+	return d.compact()
+}
+
+// compact merges the segments which exist when it starts into one.  Newer
+// segments may be flushed while it runs, they are unaffected.
+func (d *Dictionary) compact() error {
+	d.compactM.Lock()
+	defer d.compactM.Unlock()
+
+	d.m.RLock()
+	if d.closed {
+		d.m.RUnlock()
+		return vellum.ErrClosed
+	}
+	segments := append([]*segment(nil), d.segments...)
+	d.m.RUnlock()
+	if len(segments) < 2 {
+		return nil
+	}
+
+	// only compaction and Close (which waits for it) close segments, so
+	// they remain open while they are merged, the newest value wins
+	var itrs []vellum.Iterator
+	for _, s := range segments {
+		itr, err := s.fst.Iterator(nil, nil)
+		if err == vellum.ErrIteratorDone {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		itrs = append(itrs, itr)
+	}
+	merged, err := d.writeSegment(segments[len(segments)-1].minID,
+		segments[0].maxID, func(w io.Writer) error {
+			return vellum.MergeWithDelete(w, d.opts.BuilderOpts, itrs, mergePurge)
+		})
+	if err != nil {
+		return err
+	}
+
+	// the segments merged are the oldest, any flushed since are newer
+	d.m.Lock()
+	d.segments = append(d.segments[:len(d.segments)-len(segments):len(d.segments)-len(segments)],
+		merged)
+	d.m.Unlock()
+
+	// iterators holding references keep the merged FSTs usable until
+	// they are closed, the files can already be removed
+	return d.removeSegments(segments)
+}
+
+// mergeNewest is the MergeFunc choosing the newest value, the iterators
+// being merged are always ordered newest first.
+func mergeNewest(vals []uint64) uint64 {
+	return vals[0]
+}
+
+// mergePurge is the MergeDeleteFunc choosing the newest value, and
+// dropping deleted keys.  Compactions always include the oldest segment,
+// so no older value remains for a tombstone to hide.
+func mergePurge(vals []uint64) (uint64, bool) {
+	return vals[0], vals[0] != Tombstone
+}
+
+func (d *Dictionary) closeSegments(segments []*segment) {
+	for _, s := range segments {
+		_ = s.fst.Close()
+	}
+}
+
+func (d *Dictionary) removeSegments(segments []*segment) error {
+	var rv error
+	for _, s := range segments {
+		err := s.fst.Close()
+		if err == nil && s.path != "" {
+			err = os.Remove(s.path)
+		}
+		if rv == nil {
+			rv = err
+		}
+	}
+	return rv
+}
+
+// Close flushes the memtable, if the Dictionary has a directory, waits for
+// any compaction running in the background, and closes the segments.
+// Iterators still open remain usable until they are closed.  The first
+// error of a background compaction, if any, is returned.
+func (d *Dictionary) Close() error {
+	d.compactM.Lock()
+	defer d.compactM.Unlock()
+	d.m.Lock()
+	defer d.m.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+
+	var err error
+	if d.opts.Dir != "" {
+		err = d.flushLocked(false)
+	}
+	d.closeSegments(d.segments)
+	d.segments = nil
+	if err == nil {
+		err = d.err
+	}
+	return err
+}
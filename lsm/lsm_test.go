@@ -0,0 +1,493 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsm
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/couchbase/vellum"
+	"github.com/couchbase/vellum/regexp"
+)
+
+// checkDictionary verifies that Get and Iterator agree with the model.
+func checkDictionary(t *testing.T, d *Dictionary, model map[string]uint64) {
+	t.Helper()
+	for k, v := range model {
+		got, exists, err := d.Get([]byte(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists || got != v {
+			t.Fatalf("get %q: expected %d, got %d (exists %t)", k, v, got, exists)
+		}
+	}
+	var keys []string
+	for k := range model {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var got []string
+	itr, err := d.Iterator(nil, nil)
+	for err == nil {
+		k, v := itr.Current()
+		if model[string(k)] != v {
+			t.Fatalf("iterator %q: expected %d, got %d", k, model[string(k)], v)
+		}
+		got = append(got, string(k))
+		err = itr.Next()
+	}
+	if err != vellum.ErrIteratorDone {
+		t.Fatal(err)
+	}
+	if itr != nil {
+		err = itr.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(keys) {
+		t.Fatalf("iterator: expected %d keys, got %d", len(keys), len(got))
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmp)
+	}()
+
+	for _, dir := range []string{"", tmp} {
+		t.Run(fmt.Sprintf("dir=%q", dir), func(t *testing.T) {
+			d, err := Open(&Options{
+				Dir:          dir,
+				MemtableSize: 50,
+				MaxSegments:  3,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rng := rand.New(rand.NewSource(1))
+			model := map[string]uint64{}
+			for i := 0; i < 2000; i++ {
+				key := fmt.Sprintf("key%04d", rng.Intn(500))
+				if rng.Intn(4) == 0 {
+					err = d.Delete([]byte(key))
+					delete(model, key)
+				} else {
+					model[key] = uint64(i)
+					err = d.Set([]byte(key), uint64(i))
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i%500 == 0 {
+					checkDictionary(t, d, model)
+				}
+			}
+			checkDictionary(t, d, model)
+
+			err = d.Compact()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkDictionary(t, d, model)
+
+			_, exists, err := d.Get([]byte("missing"))
+			if err != nil || exists {
+				t.Fatalf("expected missing key not to exist, got %t %v", exists, err)
+			}
+
+			err = d.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, err = d.Get([]byte("key0000"))
+			if err != vellum.ErrClosed {
+				t.Fatalf("expected ErrClosed, got %v", err)
+			}
+			if dir == "" {
+				return
+			}
+
+			// reopening loads the segments, including the memtable
+			// flushed by Close
+			d, err = Open(&Options{Dir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkDictionary(t, d, model)
+			err = d.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestDictionarySetTombstone(t *testing.T) {
+	d, err := Open(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = d.Close()
+	}()
+	err = d.Set([]byte("a"), Tombstone)
+	if err == nil {
+		t.Fatal("expected error storing the tombstone value")
+	}
+}
+
+func TestDictionaryOpenInterruptedCompaction(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmp)
+	}()
+
+	d, err := Open(&Options{Dir: tmp, MaxSegments: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []string{"a", "b", "a"} {
+		err = d.Set([]byte(key), uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = d.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = d.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// leave a copy of the original segments behind, as a compaction
+	// interrupted before removing them would
+	names, err := filepath.Glob(filepath.Join(tmp, "segment-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := map[string][]byte{}
+	for _, name := range names {
+		saved[name], err = ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, err = Open(&Options{Dir: tmp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range saved {
+		err = ioutil.WriteFile(name, data, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = ioutil.WriteFile(filepath.Join(tmp, "segment-tmp-1"), []byte("partial"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = Open(&Options{Dir: tmp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDictionary(t, d, map[string]uint64{"a": 2, "b": 1})
+	err = d.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err = filepath.Glob(filepath.Join(tmp, "segment-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || filepath.Base(names[0]) != "segment-00000000-00000002.fst" {
+		t.Errorf("expected only the compacted segment, got %v", names)
+	}
+}
+
+func TestDictionaryIteratorSnapshot(t *testing.T) {
+	d, err := Open(&Options{MemtableSize: 10, MaxSegments: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		err = d.Set([]byte(fmt.Sprintf("%02d", i)), uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	itr, err := d.Iterator([]byte("05"), []byte("25"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the iterator keeps using the segments it started with, and the
+	// memtable as it was
+	for i := 0; i < 30; i++ {
+		err = d.Delete([]byte(fmt.Sprintf("%02d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = d.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 5
+	for err == nil {
+		k, v := itr.Current()
+		if string(k) != fmt.Sprintf("%02d", n) || v != uint64(n) {
+			t.Fatalf("expected %02d/%d, got %s/%d", n, n, k, v)
+		}
+		n++
+		err = itr.Next()
+	}
+	if err != vellum.ErrIteratorDone {
+		t.Fatal(err)
+	}
+	if n != 25 {
+		t.Errorf("expected to iterate up to 25, got %d", n)
+	}
+	err = itr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDictionarySearch(t *testing.T) {
+	d, err := Open(&Options{MemtableSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = d.Close()
+	}()
+	words := []string{"cat", "car", "cart", "dog", "care", "cab", "card"}
+	for i, word := range words {
+		err = d.Set([]byte(word), uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = d.Delete([]byte("cart"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := regexp.New("car.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	itr, err := d.Search(r, nil, nil)
+	var got []string
+	for err == nil {
+		k, _ := itr.Current()
+		got = append(got, string(k))
+		err = itr.Next()
+	}
+	if err != vellum.ErrIteratorDone {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[car card care]" {
+		t.Errorf("expected [car card care], got %v", got)
+	}
+
+	itr, err = d.Iterator(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = itr.Seek([]byte("cars"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, _ := itr.Current()
+	if !bytes.Equal(k, []byte("cat")) {
+		t.Errorf("expected seek past deleted key to cat, got %s", k)
+	}
+	err = itr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = d.Iterator([]byte("x"), nil)
+	if err != vellum.ErrIteratorDone {
+		t.Errorf("expected ErrIteratorDone, got %v", err)
+	}
+}
+
+func TestDictionaryConcurrent(t *testing.T) {
+	d, err := Open(&Options{MemtableSize: 20, MaxSegments: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := []byte(fmt.Sprintf("%d-%03d", w, i))
+				err := d.Set(key, uint64(i))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				val, exists, err := d.Get(key)
+				if err != nil || !exists || val != uint64(i) {
+					t.Errorf("get %s: %d %t %v", key, val, exists, err)
+					return
+				}
+				if i%50 == 0 {
+					itr, err := d.Iterator(nil, nil)
+					for err == nil {
+						err = itr.Next()
+					}
+					if err != vellum.ErrIteratorDone {
+						t.Error(err)
+						return
+					}
+					_ = itr.Close()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	err = d.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDictionaryCompactPurgesDeletes(t *testing.T) {
+	d, err := Open(&Options{MaxSegments: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = d.Close()
+	}()
+	for _, key := range []string{"a", "b", "c"} {
+		err = d.Set([]byte(key), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = d.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		err = d.Delete([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = d.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.segments) != 1 {
+		t.Fatalf("expected 1 segment, got %d", len(d.segments))
+	}
+	stats, err := d.segments[0].fst.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Keys != 1 {
+		t.Errorf("expected the deleted keys to be purged, got %d keys", stats.Keys)
+	}
+	checkDictionary(t, d, map[string]uint64{"b": 1})
+}
+
+func TestDictionaryEmptyKey(t *testing.T) {
+	// a memtable of one key flushes each key to its own segment
+	d, err := Open(&Options{MemtableSize: 1, MaxSegments: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = d.Close()
+	}()
+	err = d.Set([]byte(""), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Set([]byte("a"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDictionary(t, d, map[string]uint64{"": 7, "a": 1})
+
+	err = d.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDictionary(t, d, map[string]uint64{"": 7, "a": 1})
+
+	err = d.Set([]byte(""), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Delete([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDictionary(t, d, map[string]uint64{"": 8})
+	err = d.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDictionary(t, d, map[string]uint64{"": 8})
+}
@@ -0,0 +1,153 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/couchbase/vellum"
+)
+
+// memEntry is a key and its value (which may be Tombstone) in a memtable
+type memEntry struct {
+	key []byte
+	val uint64
+}
+
+// memtable holds the most recent writes, until they are flushed to a
+// segment.  Readers use immutable sorted snapshots of it.  The entries are
+// protected by the lock of the Dictionary, the snapshot may also be taken
+// by readers, so it has its own.
+type memtable struct {
+	entries map[string]uint64
+
+	m        sync.Mutex
+	snapshot []memEntry // nil when entries changed since it was taken
+}
+
+func newMemtable() *memtable {
+	return &memtable{
+		entries: map[string]uint64{},
+	}
+}
+
+func (m *memtable) set(key []byte, val uint64) {
+	m.entries[string(key)] = val
+	m.m.Lock()
+	m.snapshot = nil
+	m.m.Unlock()
+}
+
+func (m *memtable) get(key []byte) (uint64, bool) {
+	val, ok := m.entries[string(key)]
+	return val, ok
+}
+
+func (m *memtable) len() int {
+	return len(m.entries)
+}
+
+// sorted returns the entries in key order.  The slice returned is never
+// modified, so it may be used after the memtable changes.
+func (m *memtable) sorted() []memEntry {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if m.snapshot == nil {
+		m.snapshot = make([]memEntry, 0, len(m.entries))
+		for k, v := range m.entries {
+			m.snapshot = append(m.snapshot, memEntry{key: []byte(k), val: v})
+		}
+		sort.Slice(m.snapshot, func(i, j int) bool {
+			return bytes.Compare(m.snapshot[i].key, m.snapshot[j].key) < 0
+		})
+	}
+	return m.snapshot
+}
+
+// memIterator implements vellum.Iterator over a snapshot of a memtable.
+type memIterator struct {
+	entries []memEntry
+	aut     vellum.Automaton
+	start   []byte
+	end     []byte
+	pos     int
+}
+
+// newMemIterator returns an iterator over the entries between start and
+// end which the automaton (if not nil) matches.  Like FST.Iterator, it
+// returns vellum.ErrIteratorDone if there are none.
+func newMemIterator(entries []memEntry, aut vellum.Automaton,
+	start, end []byte) (*memIterator, error) {
+	rv := &memIterator{
+		entries: entries,
+		aut:     aut,
+		start:   start,
+		end:     end,
+	}
+	err := rv.Seek(start)
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+func (i *memIterator) Current() ([]byte, uint64) {
+	if i.pos >= len(i.entries) {
+		return nil, 0
+	}
+	return i.entries[i.pos].key, i.entries[i.pos].val
+}
+
+func (i *memIterator) Next() error {
+	i.pos++
+	return i.skip()
+}
+
+func (i *memIterator) Seek(key []byte) error {
+	if bytes.Compare(key, i.start) < 0 {
+		key = i.start
+	}
+	i.pos = sort.Search(len(i.entries), func(n int) bool {
+		return bytes.Compare(i.entries[n].key, key) >= 0
+	})
+	return i.skip()
+}
+
+// skip moves forward to the first entry the automaton matches, and checks
+// the end of the range.
+func (i *memIterator) skip() error {
+	for ; i.pos < len(i.entries); i.pos++ {
+		key := i.entries[i.pos].key
+		if i.end != nil && bytes.Compare(key, i.end) >= 0 {
+			break
+		}
+		if i.aut == nil || vellum.AutomatonContains(i.aut, key) {
+			return nil
+		}
+	}
+	i.pos = len(i.entries)
+	return vellum.ErrIteratorDone
+}
+
+func (i *memIterator) Reset(*vellum.FST, []byte, []byte, vellum.Automaton) error {
+	return fmt.Errorf("memtable iterator can not be reset")
+}
+
+func (i *memIterator) Close() error {
+	return nil
+}
@@ -25,39 +25,113 @@ import (
 // implementations to prioritize one iterator over another.
 type MergeFunc func([]uint64) uint64
 
+// MergeDeleteFunc is used like MergeFunc to choose the new value for a key
+// when merging a slice of iterators, but it may also delete the key, by
+// returning false.  Unlike MergeFunc, it is invoked for every key, even
+// those observed with a single value, so that keys (such as tombstones
+// recording deletes) can be dropped wherever they come from.
+type MergeDeleteFunc func([]uint64) (uint64, bool)
+
+// MergeValue is one of the values observed for a key when merging a slice
+// of iterators, along with the index in the slice of the iterator (the
+// source) it came from.
+type MergeValue struct {
+	Source int
+	Val    uint64
+}
+
+// KeyedMergeFunc is used to choose the new value for a key when merging a
+// slice of iterators, with access to the key, and to the source of each
+// value, for example to prefer the value of the newest of several
+// segments, or to apply a different policy to some keys.  It is invoked for
+// every key, the values are presented in the order of their sources, and
+// it may delete the key by returning false.  The key and the values are
+// only valid until it returns.
+type KeyedMergeFunc func(key []byte, vals []MergeValue) (uint64, bool)
+
+// keyedMergeFunc adapts a MergeFunc to a KeyedMergeFunc, which only invokes
+// it for keys observed with multiple values.  It reuses a buffer, so each
+// MergeIterator must have its own.
+func keyedMergeFunc(f MergeFunc) KeyedMergeFunc {
+	var vals []uint64
+	return func(key []byte, mvs []MergeValue) (uint64, bool) {
+		if len(mvs) == 1 {
+			return mvs[0].Val, true
+		}
+		vals = mergeValues(vals[:0], mvs)
+		return f(vals), true
+	}
+}
+
+// keyedMergeDeleteFunc adapts a MergeDeleteFunc to a KeyedMergeFunc.  It
+// reuses a buffer, so each MergeIterator must have its own.
+func keyedMergeDeleteFunc(f MergeDeleteFunc) KeyedMergeFunc {
+	var vals []uint64
+	return func(key []byte, mvs []MergeValue) (uint64, bool) {
+		vals = mergeValues(vals[:0], mvs)
+		return f(vals)
+	}
+}
+
+func mergeValues(vals []uint64, mvs []MergeValue) []uint64 {
+	for _, mv := range mvs {
+		vals = append(vals, mv.Val)
+	}
+	return vals
+}
+
 // MergeIterator implements the Iterator interface by traversing a slice
 // of iterators and merging the contents of them.  If the same key exists
 // in mulitipe underlying iterators, a user-provided MergeFunc will be
-// invoked to choose the new value.
+// invoked to choose the new value (or for every key, a KeyedMergeFunc).
+// The underlying iterators must each point at a key when the MergeIterator
+// is created, as they do when created without error.  Whether one is done
+// is tracked from the errors returned by its Next/Seek methods, not from
+// its key, which may be nil for the empty key.
 type MergeIterator struct {
-	itrs   []Iterator
-	f      MergeFunc
-	currKs [][]byte
-	currVs []uint64
+	itrs     []Iterator
+	f        KeyedMergeFunc
+	currKs   [][]byte
+	currVs   []uint64
+	currDone []bool
 
+	haveLow bool
 	lowK    []byte
 	lowV    uint64
 	lowIdxs []int
+	lowKeep bool
 
-	mergeV []uint64
+	mergeV []MergeValue
 }
 
 // NewMergeIterator creates a new MergeIterator over the provided slice of
 // Iterators and with the specified MergeFunc to resolve duplicate keys.
 func NewMergeIterator(itrs []Iterator, f MergeFunc) (*MergeIterator, error) {
+	return NewKeyedMergeIterator(itrs, keyedMergeFunc(f))
+}
+
+// NewMergeDeleteIterator creates a new MergeIterator over the provided slice
+// of Iterators, with the specified MergeDeleteFunc choosing the value of
+// every key, or deleting it.
+func NewMergeDeleteIterator(itrs []Iterator, f MergeDeleteFunc) (*MergeIterator, error) {
+	return NewKeyedMergeIterator(itrs, keyedMergeDeleteFunc(f))
+}
+
+// NewKeyedMergeIterator creates a new MergeIterator over the provided slice
+// of Iterators, with the specified KeyedMergeFunc choosing the value of
+// every key, or deleting it.
+func NewKeyedMergeIterator(itrs []Iterator, f KeyedMergeFunc) (*MergeIterator, error) {
 	rv := &MergeIterator{
-		itrs:    itrs,
-		f:       f,
-		currKs:  make([][]byte, len(itrs)),
-		currVs:  make([]uint64, len(itrs)),
-		lowIdxs: make([]int, 0, len(itrs)),
-		mergeV:  make([]uint64, 0, len(itrs)),
+		itrs:     itrs,
+		f:        f,
+		currKs:   make([][]byte, len(itrs)),
+		currVs:   make([]uint64, len(itrs)),
+		currDone: make([]bool, len(itrs)),
+		lowIdxs:  make([]int, 0, len(itrs)),
+		mergeV:   make([]MergeValue, 0, len(itrs)),
 	}
 	rv.init()
-	if rv.lowK == nil {
-		return rv, ErrIteratorDone
-	}
-	return rv, nil
+	return rv, rv.skipDeleted()
 }
 
 func (m *MergeIterator) init() {
@@ -71,16 +145,16 @@ func (m *MergeIterator) updateMatches() {
 	if len(m.itrs) < 1 {
 		return
 	}
-	m.lowK = m.currKs[0]
+	m.haveLow, m.lowK = false, nil
 	m.lowIdxs = m.lowIdxs[:0]
-	m.lowIdxs = append(m.lowIdxs, 0)
-	for i := 1; i < len(m.itrs); i++ {
-		if m.currKs[i] == nil {
+	for i := 0; i < len(m.itrs); i++ {
+		if m.currDone[i] {
 			continue
 		}
 		cmp := bytes.Compare(m.currKs[i], m.lowK)
-		if m.lowK == nil || cmp < 0 {
+		if !m.haveLow || cmp < 0 {
 			// reached a new low
+			m.haveLow = true
 			m.lowK = m.currKs[i]
 			m.lowIdxs = m.lowIdxs[:0]
 			m.lowIdxs = append(m.lowIdxs, i)
@@ -88,18 +162,28 @@ func (m *MergeIterator) updateMatches() {
 			m.lowIdxs = append(m.lowIdxs, i)
 		}
 	}
-	if len(m.lowIdxs) > 1 {
-		// merge multiple values
+	m.lowV, m.lowKeep = 0, true
+	if m.haveLow {
 		m.mergeV = m.mergeV[:0]
 		for _, vi := range m.lowIdxs {
-			m.mergeV = append(m.mergeV, m.currVs[vi])
+			m.mergeV = append(m.mergeV, MergeValue{Source: vi, Val: m.currVs[vi]})
 		}
-		m.lowV = m.f(m.mergeV)
-	} else if len(m.lowIdxs) == 1 {
-		m.lowV = m.currVs[m.lowIdxs[0]]
+		m.lowV, m.lowKeep = m.f(m.lowK, m.mergeV)
 	}
 }
 
+// updateCurrent records the key and value of the iterator i after it
+// moved, an iterator which is done (which may still point at the key past
+// the end of its range) has none.
+func (m *MergeIterator) updateCurrent(i int, err error) {
+	m.currDone[i] = err == ErrIteratorDone
+	if m.currDone[i] {
+		m.currKs[i], m.currVs[i] = nil, 0
+		return
+	}
+	m.currKs[i], m.currVs[i] = m.itrs[i].Current()
+}
+
 // Current returns the key and value currently pointed to by this iterator.
 // If the iterator is not pointing at a valid value (because Iterator/Next/Seek)
 // returned an error previously, it may return nil,0.
@@ -110,16 +194,40 @@ func (m *MergeIterator) Current() ([]byte, uint64) {
 // Next advances this iterator to the next key/value pair.  If there is none,
 // then ErrIteratorDone is returned.
 func (m *MergeIterator) Next() error {
-	// move all the current low iterators to next
+	err := m.next()
+	if err != nil {
+		return err
+	}
+	return m.skipDeleted()
+}
+
+// next moves all the current low iterators to next, returning
+// ErrIteratorDone if there are no more keys.
+func (m *MergeIterator) next() error {
 	for _, vi := range m.lowIdxs {
 		err := m.itrs[vi].Next()
 		if err != nil && err != ErrIteratorDone {
 			return err
 		}
-		m.currKs[vi], m.currVs[vi] = m.itrs[vi].Current()
+		m.updateCurrent(vi, err)
 	}
 	m.updateMatches()
-	if m.lowK == nil {
+	if !m.haveLow {
+		return ErrIteratorDone
+	}
+	return nil
+}
+
+// skipDeleted moves past any keys the merge function deleted, returning
+// ErrIteratorDone if there are no more keys.
+func (m *MergeIterator) skipDeleted() error {
+	for m.haveLow && !m.lowKeep {
+		err := m.next()
+		if err != nil {
+			return err
+		}
+	}
+	if !m.haveLow {
 		return ErrIteratorDone
 	}
 	return nil
@@ -134,12 +242,10 @@ func (m *MergeIterator) Seek(key []byte) error {
 		if err != nil && err != ErrIteratorDone {
 			return err
 		}
+		m.updateCurrent(i, err)
 	}
 	m.updateMatches()
-	if m.lowK == nil {
-		return ErrIteratorDone
-	}
-	return nil
+	return m.skipDeleted()
 }
 
 // Close will attempt to close all the underlying Iterators.  If any errors
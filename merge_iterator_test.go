@@ -15,6 +15,7 @@
 package vellum
 
 import (
+	"bytes"
 	"reflect"
 	"sort"
 	"testing"
@@ -275,3 +276,267 @@ func TestEmptyMergeIterator(t *testing.T) {
 	}
 
 }
+
+func TestMergeIteratorSeekAndRanges(t *testing.T) {
+	var buf bytes.Buffer
+	builder, err := New(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []string{"a", "c", "e", "g"} {
+		err = builder.Insert([]byte(key), uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = builder.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst, err := Load(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the FST iterator ends before "g", it must not be reported
+	fstItr, err := fst.Iterator(nil, []byte("f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testItr, err := newTestIterator(map[string]uint64{"b": 10, "d": 11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	itr, err := NewMergeIterator([]Iterator{fstItr, testItr}, MergeMin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = itr.Seek([]byte("bb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for err == nil {
+		k, _ := itr.Current()
+		got = append(got, string(k))
+		err = itr.Next()
+	}
+	if err != ErrIteratorDone {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"c", "d", "e"}) {
+		t.Errorf("expected [c d e], got %v", got)
+	}
+}
+
+func TestMergeDeleteIterator(t *testing.T) {
+	// odd values are deletes, the first iterator takes precedence
+	deleteOdd := func(vals []uint64) (uint64, bool) {
+		return vals[0], vals[0]%2 == 0
+	}
+	itr0, _ := newTestIterator(map[string]uint64{"a": 1, "b": 2, "d": 3})
+	itr1, _ := newTestIterator(map[string]uint64{"a": 4, "c": 6, "d": 8, "e": 9})
+	itr, err := NewMergeDeleteIterator([]Iterator{itr0, itr1}, deleteOdd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]uint64{}
+	for err == nil {
+		k, v := itr.Current()
+		got[string(k)] = v
+		err = itr.Next()
+	}
+	if err != ErrIteratorDone {
+		t.Fatal(err)
+	}
+	want := map[string]uint64{"b": 2, "c": 6}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	err = itr.Seek([]byte("c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, _ := itr.Current()
+	if string(k) != "c" {
+		t.Errorf("expected seek to c, got %s", k)
+	}
+	err = itr.Seek([]byte("cc"))
+	if err != ErrIteratorDone {
+		t.Errorf("expected iterator done past deleted keys, got %v", err)
+	}
+
+	// every key deleted
+	itr0, _ = newTestIterator(map[string]uint64{"a": 1})
+	_, err = NewMergeDeleteIterator([]Iterator{itr0}, deleteOdd)
+	if err != ErrIteratorDone {
+		t.Errorf("expected iterator done, got %v", err)
+	}
+}
+
+func TestMergeWithDelete(t *testing.T) {
+	itr0, _ := newTestIterator(map[string]uint64{"a": 0, "b": 1})
+	itr1, _ := newTestIterator(map[string]uint64{"b": 2, "c": 3})
+	var buf bytes.Buffer
+	err := MergeWithDelete(&buf, nil, []Iterator{itr0, itr1},
+		func(vals []uint64) (uint64, bool) {
+			return MergeMax(vals), len(vals) == 1
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst, err := Load(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]uint64{}
+	itr, err := fst.Iterator(nil, nil)
+	for err == nil {
+		k, v := itr.Current()
+		got[string(k)] = v
+		err = itr.Next()
+	}
+	if err != ErrIteratorDone {
+		t.Fatal(err)
+	}
+	want := map[string]uint64{"a": 0, "c": 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestKeyedMergeIterator(t *testing.T) {
+	itr0, _ := newTestIterator(map[string]uint64{"a": 1, "b": 2, "tmp/x": 3})
+	itr1, _ := newTestIterator(map[string]uint64{"b": 20, "c": 30, "tmp/y": 40})
+	itr2, _ := newTestIterator(map[string]uint64{"a": 100, "b": 200})
+
+	type call struct {
+		key  string
+		vals []MergeValue
+	}
+	var calls []call
+	// prefer the newest source (the highest index), drop temporary keys
+	newest := func(key []byte, vals []MergeValue) (uint64, bool) {
+		calls = append(calls, call{string(key), append([]MergeValue(nil), vals...)})
+		if bytes.HasPrefix(key, []byte("tmp/")) {
+			return 0, false
+		}
+		return vals[len(vals)-1].Val, true
+	}
+	itr, err := NewKeyedMergeIterator([]Iterator{itr0, itr1, itr2}, newest)
+	got := collectIterator(t, itr, err)
+	want := []keyVal{{"a", 100}, {"b", 200}, {"c", 30}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	wantCalls := []call{
+		{"a", []MergeValue{{0, 1}, {2, 100}}},
+		{"b", []MergeValue{{0, 2}, {1, 20}, {2, 200}}},
+		{"c", []MergeValue{{1, 30}}},
+		{"tmp/x", []MergeValue{{0, 3}}},
+		{"tmp/y", []MergeValue{{1, 40}}},
+	}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("expected calls %v, got %v", wantCalls, calls)
+	}
+}
+
+func TestMergeKeyed(t *testing.T) {
+	itr0, _ := newTestIterator(map[string]uint64{"a": 1, "b": 2})
+	itr1, _ := newTestIterator(map[string]uint64{"b": 20, "c": 30})
+	var buf bytes.Buffer
+	err := MergeKeyed(&buf, nil, []Iterator{itr0, itr1},
+		func(key []byte, vals []MergeValue) (uint64, bool) {
+			// sum the values, only keeping keys from the first source
+			var sum uint64
+			for _, v := range vals {
+				sum += v.Val
+			}
+			return sum, vals[0].Source == 0
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst, err := Load(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	itr, err := fst.Iterator(nil, nil)
+	got := collectIterator(t, itr, err)
+	want := []keyVal{{"a", 1}, {"b", 22}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestMergeFuncOnlyCalledForDuplicates(t *testing.T) {
+	itr0, _ := newTestIterator(map[string]uint64{"a": 1, "b": 2})
+	itr1, _ := newTestIterator(map[string]uint64{"b": 3})
+	var calls int
+	itr, err := NewMergeIterator([]Iterator{itr0, itr1}, func(vals []uint64) uint64 {
+		calls++
+		return MergeSum(vals)
+	})
+	got := collectIterator(t, itr, err)
+	want := []keyVal{{"a", 1}, {"b", 5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call of the MergeFunc, got %d", calls)
+	}
+}
+
+func TestMergeIteratorEmptyKey(t *testing.T) {
+	// an FSTIterator returns the empty key as nil, which must not be
+	// mistaken for the end of the source
+	fst0, err := Load(buildTestFST(t, nil, []string{"", "b"}, []uint64{1, 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst1, err := Load(buildTestFST(t, nil, []string{"", "a"}, []uint64{10, 20}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newItrs := func() []Iterator {
+		itr0, err := fst0.Iterator(nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		itr1, err := fst1.Iterator(nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []Iterator{itr0, itr1}
+	}
+
+	itr, err := NewMergeIterator(newItrs(), MergeSum)
+	got := collectIterator(t, itr, err)
+	want := []keyVal{{"", 11}, {"a", 20}, {"b", 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// deleting the empty key leaves the rest
+	itr, err = NewMergeDeleteIterator(newItrs(), func(vals []uint64) (uint64, bool) {
+		return MergeSum(vals), len(vals) == 1
+	})
+	got = collectIterator(t, itr, err)
+	want = []keyVal{{"a", 20}, {"b", 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// seeking back to the deleted empty key finds the key after it
+	err = itr.Seek(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, val := itr.Current()
+	if string(key) != "a" || val != 20 {
+		t.Errorf("expected a 20 after seek, got %q %d", key, val)
+	}
+}
@@ -0,0 +1,100 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// encodeMetadata encodes the metadata as a uvarint number of entries,
+// followed by each key and value (in key order) as a uvarint length
+// and the bytes themselves.
+func encodeMetadata(meta map[string][]byte) []byte {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(keys)))
+	rv := append([]byte(nil), buf[:n]...)
+	for _, k := range keys {
+		n = binary.PutUvarint(buf[:], uint64(len(k)))
+		rv = append(rv, buf[:n]...)
+		rv = append(rv, k...)
+		n = binary.PutUvarint(buf[:], uint64(len(meta[k])))
+		rv = append(rv, buf[:n]...)
+		rv = append(rv, meta[k]...)
+	}
+	return rv
+}
+
+// decodeMetadata decodes metadata encoded by encodeMetadata, the values
+// returned share the provided data.  The offset of the data is only used
+// to report the location of any corruption.
+func decodeMetadata(data []byte, offset int) (map[string][]byte, error) {
+	start := offset
+	readUvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(data)
+		if n == 0 {
+			return 0, truncatedError(offset, "invalid metadata")
+		} else if n < 0 {
+			return 0, corruptError(offset, "invalid metadata")
+		}
+		data = data[n:]
+		offset += n
+		return v, nil
+	}
+	readBytes := func() ([]byte, error) {
+		l, err := readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		if l > uint64(len(data)) {
+			return nil, truncatedError(offset,
+				fmt.Sprintf("invalid metadata length %d", l))
+		}
+		rv := data[:l]
+		data = data[l:]
+		offset += int(l)
+		return rv, nil
+	}
+
+	num, err := readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	// each entry requires at least 2 bytes
+	if num > uint64(len(data)/2) {
+		return nil, corruptError(start,
+			fmt.Sprintf("invalid number of metadata entries %d", num))
+	}
+	rv := make(map[string][]byte, num)
+	for i := uint64(0); i < num; i++ {
+		k, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		v, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		rv[string(k)] = v
+	}
+	return rv, nil
+}
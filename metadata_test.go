@@ -0,0 +1,119 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	tests := []map[string][]byte{
+		{},
+		{"creator": []byte("vellum")},
+		{"creator": []byte("vellum"), "built": []byte("2017-01-01"), "empty": {}},
+	}
+	for _, test := range tests {
+		got, err := decodeMetadata(encodeMetadata(test), 0)
+		if err != nil {
+			t.Fatalf("error decoding metadata: %v", err)
+		}
+		if !reflect.DeepEqual(test, got) {
+			t.Errorf("expected %v, got %v", test, got)
+		}
+	}
+}
+
+func TestMetadataInvalid(t *testing.T) {
+	data := encodeMetadata(map[string][]byte{"creator": []byte("vellum")})
+	for i := 0; i < len(data); i++ {
+		_, err := decodeMetadata(data[:i], 0)
+		if err == nil {
+			t.Errorf("expected error decoding truncated metadata len %d, got nil", i)
+		}
+	}
+}
+
+func TestFSTMetadata(t *testing.T) {
+	meta := map[string][]byte{
+		"creator": []byte("vellum test"),
+		"schema":  {1, 2, 3},
+	}
+
+	var buf bytes.Buffer
+	b, err := New(&buf, &BuilderOpts{
+		Encoder:           1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+		Metadata:          meta,
+	})
+	if err != nil {
+		t.Fatalf("error creating builder: %v", err)
+	}
+	err = insertStringMap(b, smallSample)
+	if err != nil {
+		t.Fatalf("error building: %v", err)
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatalf("error closing: %v", err)
+	}
+
+	fst, err := Load(buf.Bytes())
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	if !reflect.DeepEqual(meta, fst.Metadata()) {
+		t.Errorf("expected metadata %v, got %v", meta, fst.Metadata())
+	}
+	if fst.Type()&typeMetadata == 0 {
+		t.Errorf("expected type to have metadata flag, got %d", fst.Type())
+	}
+	for k, v := range smallSample {
+		got, exists, err := fst.Get([]byte(k))
+		if err != nil {
+			t.Fatalf("error getting %s: %v", k, err)
+		}
+		if !exists || got != v {
+			t.Errorf("expected %s to have value %d, got %d %t", k, v, got, exists)
+		}
+	}
+
+	// same data without metadata should have no metadata
+	buf.Reset()
+	b, err = New(&buf, nil)
+	if err != nil {
+		t.Fatalf("error creating builder: %v", err)
+	}
+	err = insertStringMap(b, smallSample)
+	if err != nil {
+		t.Fatalf("error building: %v", err)
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatalf("error closing: %v", err)
+	}
+	fst, err = Load(buf.Bytes())
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	if fst.Metadata() != nil {
+		t.Errorf("expected nil metadata, got %v", fst.Metadata())
+	}
+	if fst.Type() != 0 {
+		t.Errorf("expected type 0, got %d", fst.Type())
+	}
+}
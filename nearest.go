@@ -0,0 +1,230 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+// Floor returns the largest key in the FST which is less than or equal to
+// the provided key, its value, and whether or not any such key exists.
+// The FST is descended once along the provided key, backtracking along the
+// same path only as far as needed, no iterator is created.
+func (f *FST) Floor(key []byte) ([]byte, uint64, bool, error) {
+	err := f.rlock()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer f.mu.RUnlock()
+	var p nearestPath
+	return p.floor(f, key)
+}
+
+// Ceiling returns the smallest key in the FST which is greater than or
+// equal to the provided key, its value, and whether or not any such key
+// exists.  Like Floor, it is implemented as a single descent.
+func (f *FST) Ceiling(key []byte) ([]byte, uint64, bool, error) {
+	err := f.rlock()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer f.mu.RUnlock()
+	var p nearestPath
+	return p.ceiling(f, key)
+}
+
+// Floor is like FST.Floor, reusing the states of the Reader.  The key
+// returned is also reused, it is only valid until the next call.
+func (r *Reader) Floor(key []byte) ([]byte, uint64, bool, error) {
+	err := r.f.rlock()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer r.f.mu.RUnlock()
+	return r.nearest.floor(r.f, key)
+}
+
+// Ceiling is like FST.Ceiling, reusing the states of the Reader.  The key
+// returned is also reused, it is only valid until the next call.
+func (r *Reader) Ceiling(key []byte) ([]byte, uint64, bool, error) {
+	err := r.f.rlock()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer r.f.mu.RUnlock()
+	return r.nearest.ceiling(r.f, key)
+}
+
+// nearestPath is the path of states from the root used by Floor and
+// Ceiling, along with the total output on reaching each state.
+type nearestPath struct {
+	states []fstStateV1
+	outs   []uint64
+	key    []byte
+}
+
+// descend follows the key from the root as far as possible, and returns
+// the number of bytes of the key followed.  The read lock of the FST must
+// be held.
+func (p *nearestPath) descend(f *FST, key []byte) (int, error) {
+	p.states = p.states[:0]
+	p.outs = p.outs[:0]
+	err := p.push(f, f.decoder.getRoot(), 0)
+	if err != nil {
+		return 0, err
+	}
+	var depth int
+	for ; depth < len(key); depth++ {
+		_, next, out := p.states[depth].TransitionFor(key[depth])
+		if next == noneAddr {
+			break
+		}
+		err = p.push(f, next, p.outs[depth]+out)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return depth, nil
+}
+
+func (p *nearestPath) push(f *FST, addr int, out uint64) error {
+	p.states = append(p.states, fstStateV1{})
+	_, err := f.decoder.stateAt(addr, &p.states[len(p.states)-1])
+	if err != nil {
+		return err
+	}
+	p.outs = append(p.outs, out)
+	return nil
+}
+
+// follow truncates the path to depth, where the key is key[:depth], and
+// follows the transition on t from there.
+func (p *nearestPath) follow(f *FST, key []byte, depth int, t byte) error {
+	_, next, out := p.states[depth].TransitionFor(t)
+	p.states = p.states[:depth+1]
+	p.outs = p.outs[:depth+1]
+	p.key = append(append(p.key[:0], key[:depth]...), t)
+	return p.push(f, next, p.outs[depth]+out)
+}
+
+// final returns the key and value of the final state at the end of the
+// path.
+func (p *nearestPath) final() ([]byte, uint64, bool, error) {
+	top := len(p.states) - 1
+	return p.key, p.outs[top] + p.states[top].FinalOutput(), true, nil
+}
+
+func (p *nearestPath) floor(f *FST, key []byte) ([]byte, uint64, bool, error) {
+	depth, err := p.descend(f, key)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if depth == len(key) && p.states[depth].Final() {
+		p.key = append(p.key[:0], key...)
+		return p.final()
+	}
+
+	// the deepest state with a smaller alternative leads to the floor,
+	// either the largest key after a smaller transition, or the state
+	// itself, whose key is a prefix of (and so less than) the key
+	for d := depth; d >= 0; d-- {
+		if d == len(key) {
+			continue
+		}
+		state := &p.states[d]
+		for q := state.NumTransitions() - 1; q >= 0; q-- {
+			t := state.TransitionAt(q)
+			if t < key[d] {
+				err = p.follow(f, key, d, t)
+				if err != nil {
+					return nil, 0, false, err
+				}
+				return p.max(f)
+			}
+		}
+		if state.Final() {
+			p.states = p.states[:d+1]
+			p.outs = p.outs[:d+1]
+			p.key = append(p.key[:0], key[:d]...)
+			return p.final()
+		}
+	}
+	return nil, 0, false, nil
+}
+
+func (p *nearestPath) ceiling(f *FST, key []byte) ([]byte, uint64, bool, error) {
+	depth, err := p.descend(f, key)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if depth == len(key) {
+		// every key below this state is greater than or equal to the key
+		p.key = append(p.key[:0], key...)
+		return p.min(f)
+	}
+
+	// the deepest state with a greater transition leads to the ceiling
+	for d := depth; d >= 0; d-- {
+		state := &p.states[d]
+		for q := 0; q < state.NumTransitions(); q++ {
+			t := state.TransitionAt(q)
+			if t > key[d] {
+				err = p.follow(f, key, d, t)
+				if err != nil {
+					return nil, 0, false, err
+				}
+				return p.min(f)
+			}
+		}
+	}
+	return nil, 0, false, nil
+}
+
+// min extends the path to the smallest key reachable from its end.
+func (p *nearestPath) min(f *FST) ([]byte, uint64, bool, error) {
+	for {
+		top := &p.states[len(p.states)-1]
+		if top.Final() {
+			return p.final()
+		}
+		if top.NumTransitions() == 0 {
+			return nil, 0, false, nil
+		}
+		t := top.TransitionAt(0)
+		_, next, out := top.TransitionFor(t)
+		p.key = append(p.key, t)
+		err := p.push(f, next, p.outs[len(p.outs)-1]+out)
+		if err != nil {
+			return nil, 0, false, err
+		}
+	}
+}
+
+// max extends the path to the largest key reachable from its end.
+func (p *nearestPath) max(f *FST) ([]byte, uint64, bool, error) {
+	for {
+		top := &p.states[len(p.states)-1]
+		n := top.NumTransitions()
+		if n == 0 {
+			if top.Final() {
+				return p.final()
+			}
+			return nil, 0, false, nil
+		}
+		t := top.TransitionAt(n - 1)
+		_, next, out := top.TransitionFor(t)
+		p.key = append(p.key, t)
+		err := p.push(f, next, p.outs[len(p.outs)-1]+out)
+		if err != nil {
+			return nil, 0, false, err
+		}
+	}
+}
@@ -0,0 +1,167 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// nearestTestProbes returns the keys, along with keys just before and
+// after them, prefixes of them, and random keys.
+func nearestTestProbes(keys []string) [][]byte {
+	probes := [][]byte{nil, {0}, {0xff, 0xff}}
+	r := rand.New(rand.NewSource(1))
+	for _, key := range keys {
+		probes = append(probes, []byte(key), []byte(key+"\x00"),
+			[]byte(key[:len(key)/2]))
+		if len(key) > 0 {
+			before := []byte(key)
+			before[len(before)-1]--
+			probes = append(probes, before)
+		}
+		random := make([]byte, r.Intn(8))
+		for i := range random {
+			random[i] = byte('a' + r.Intn(26))
+		}
+		probes = append(probes, random)
+	}
+	return probes
+}
+
+func TestFloorCeiling(t *testing.T) {
+	keys := append([]string{""}, thousandTestWords...)
+	sort.Strings(keys)
+	vals := randomValues(keys)
+	for _, ver := range []int{versionV1, versionV3, versionV4} {
+		fst, err := Load(buildTestFST(t, &BuilderOpts{
+			Encoder:           ver,
+			RegistryTableSize: 10000,
+			RegistryMRUSize:   2,
+		}, keys, vals))
+		if err != nil {
+			t.Fatalf("version %d: error loading: %v", ver, err)
+		}
+		reader, err := fst.Reader()
+		if err != nil {
+			t.Fatalf("error creating reader: %v", err)
+		}
+
+		for _, probe := range nearestTestProbes(keys) {
+			// the first key greater than the probe
+			i := sort.Search(len(keys), func(i int) bool {
+				return keys[i] > string(probe)
+			})
+			floor := i - 1
+			ceiling := i
+			if floor >= 0 && keys[floor] == string(probe) {
+				ceiling = floor
+			}
+
+			for name, get := range map[string]func([]byte) ([]byte, uint64, bool, error){
+				"fst":    fst.Floor,
+				"reader": reader.Floor,
+			} {
+				key, val, found, err := get(probe)
+				if err != nil {
+					t.Fatalf("version %d %s: error: %v", ver, name, err)
+				}
+				if floor < 0 {
+					if found {
+						t.Errorf("version %d %s: expected no floor of %q, got %q",
+							ver, name, probe, key)
+					}
+				} else if !found || string(key) != keys[floor] || val != vals[floor] {
+					t.Errorf("version %d %s: expected floor of %q %q %d, got %q %d %t",
+						ver, name, probe, keys[floor], vals[floor], key, val, found)
+				}
+			}
+
+			for name, get := range map[string]func([]byte) ([]byte, uint64, bool, error){
+				"fst":    fst.Ceiling,
+				"reader": reader.Ceiling,
+			} {
+				key, val, found, err := get(probe)
+				if err != nil {
+					t.Fatalf("version %d %s: error: %v", ver, name, err)
+				}
+				if ceiling >= len(keys) {
+					if found {
+						t.Errorf("version %d %s: expected no ceiling of %q, got %q",
+							ver, name, probe, key)
+					}
+				} else if !found || string(key) != keys[ceiling] || val != vals[ceiling] {
+					t.Errorf("version %d %s: expected ceiling of %q %q %d, got %q %d %t",
+						ver, name, probe, keys[ceiling], vals[ceiling], key, val, found)
+				}
+			}
+		}
+	}
+}
+
+func TestFloorCeilingEmpty(t *testing.T) {
+	fst, err := Load(buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}, nil, nil))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	for _, probe := range [][]byte{nil, []byte("a")} {
+		_, _, found, err := fst.Floor(probe)
+		if err != nil || found {
+			t.Errorf("expected no floor of %q, got %t %v", probe, found, err)
+		}
+		_, _, found, err = fst.Ceiling(probe)
+		if err != nil || found {
+			t.Errorf("expected no ceiling of %q, got %t %v", probe, found, err)
+		}
+	}
+}
+
+func TestReaderCeilingReusedKey(t *testing.T) {
+	fst, err := Load(buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}, thousandTestWords, randomValues(thousandTestWords)))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	reader, err := fst.Reader()
+	if err != nil {
+		t.Fatalf("error creating reader: %v", err)
+	}
+
+	// passing the key returned back in, to step through every key
+	key, _, found, err := reader.Ceiling(nil)
+	var n int
+	for found && err == nil {
+		if string(key) != thousandTestWords[n] {
+			t.Fatalf("expected %q, got %q", thousandTestWords[n], key)
+		}
+		n++
+		key, _, found, err = reader.Ceiling(append(key, 0))
+	}
+	if err != nil || n != len(thousandTestWords) {
+		t.Errorf("expected %d keys, got %d %v", len(thousandTestWords), n, err)
+	}
+	if !bytes.Equal(key, nil) {
+		t.Errorf("expected nil key when not found, got %q", key)
+	}
+}
@@ -0,0 +1,119 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+// PrefixMatch describes a key which is a prefix of some input, the key is
+// the first Len bytes of the input.
+type PrefixMatch struct {
+	Len int
+	Val uint64
+}
+
+// LongestPrefix returns the length of the longest key which is a prefix of
+// the input (which may be the whole input), along with its value, and
+// whether or not any such key exists.  The input is only walked once.
+func (f *FST) LongestPrefix(input []byte) (int, uint64, bool, error) {
+	err := f.rlock()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer f.mu.RUnlock()
+
+	state := statePool.Get().(*fstStateV1)
+	l, val, found, err := f.longestPrefix(input, state)
+	state.data = nil // don't keep the data reachable from the pool
+	statePool.Put(state)
+	return l, val, found, err
+}
+
+// PrefixesOf returns every key which is a prefix of the input (including
+// the whole input, if it is a key), in order of increasing length.
+func (f *FST) PrefixesOf(input []byte) ([]PrefixMatch, error) {
+	err := f.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer f.mu.RUnlock()
+	return f.prefixesOf(input, nil, nil)
+}
+
+func (f *FST) longestPrefix(input []byte, prealloc fstState) (int, uint64, bool, error) {
+	var l int
+	var val uint64
+	var found bool
+	err := f.walkPrefixes(input, prealloc, func(n int, v uint64) {
+		l, val, found = n, v, true
+	})
+	return l, val, found, err
+}
+
+func (f *FST) prefixesOf(input []byte, prealloc fstState,
+	rv []PrefixMatch) ([]PrefixMatch, error) {
+	err := f.walkPrefixes(input, prealloc, func(n int, v uint64) {
+		rv = append(rv, PrefixMatch{Len: n, Val: v})
+	})
+	return rv, err
+}
+
+// walkPrefixes walks the input from the root, calling match for each
+// final state reached, with the number of bytes consumed and the value.
+func (f *FST) walkPrefixes(input []byte, prealloc fstState,
+	match func(int, uint64)) error {
+	var total uint64
+	state, err := f.decoder.stateAt(f.decoder.getRoot(), prealloc)
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		if state.Final() {
+			match(i, total+state.FinalOutput())
+		}
+		if i == len(input) {
+			return nil
+		}
+		_, curr, output := state.TransitionFor(input[i])
+		if curr == noneAddr {
+			return nil
+		}
+		state, err = f.decoder.stateAt(curr, state)
+		if err != nil {
+			return err
+		}
+		total += output
+	}
+}
+
+// LongestPrefix is like FST.LongestPrefix, reusing the state of the Reader.
+func (r *Reader) LongestPrefix(input []byte) (int, uint64, bool, error) {
+	err := r.f.rlock()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer r.f.mu.RUnlock()
+	return r.f.longestPrefix(input, &r.prealloc)
+}
+
+// PrefixesOf is like FST.PrefixesOf, reusing the state of the Reader.  The
+// slice returned is also reused, it is only valid until the next call.
+func (r *Reader) PrefixesOf(input []byte) ([]PrefixMatch, error) {
+	err := r.f.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer r.f.mu.RUnlock()
+	rv, err := r.f.prefixesOf(input, &r.prealloc, r.prefixes[:0])
+	r.prefixes = rv
+	return rv, err
+}
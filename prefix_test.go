@@ -0,0 +1,117 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLongestPrefix(t *testing.T) {
+	keys := []string{"", "a", "abc", "abcde", "b", "bcd"}
+	vals := []uint64{1, 2, 3, 4, 5, 6}
+	for _, ver := range []int{versionV1, versionV3, versionV4} {
+		fst, err := Load(buildTestFST(t, &BuilderOpts{
+			Encoder:           ver,
+			RegistryTableSize: 10000,
+			RegistryMRUSize:   2,
+		}, keys, vals))
+		if err != nil {
+			t.Fatalf("version %d: error loading: %v", ver, err)
+		}
+		reader, err := fst.Reader()
+		if err != nil {
+			t.Fatalf("error creating reader: %v", err)
+		}
+
+		tests := []struct {
+			input    string
+			longest  PrefixMatch
+			prefixes []PrefixMatch
+		}{
+			{"", PrefixMatch{0, 1}, []PrefixMatch{{0, 1}}},
+			{"a", PrefixMatch{1, 2}, []PrefixMatch{{0, 1}, {1, 2}}},
+			{"ab", PrefixMatch{1, 2}, []PrefixMatch{{0, 1}, {1, 2}}},
+			{"abcdefg", PrefixMatch{5, 4},
+				[]PrefixMatch{{0, 1}, {1, 2}, {3, 3}, {5, 4}}},
+			{"abcz", PrefixMatch{3, 3},
+				[]PrefixMatch{{0, 1}, {1, 2}, {3, 3}}},
+			{"bc", PrefixMatch{1, 5}, []PrefixMatch{{0, 1}, {1, 5}}},
+			{"z", PrefixMatch{0, 1}, []PrefixMatch{{0, 1}}},
+		}
+		for _, test := range tests {
+			for name, longestPrefix := range map[string]func([]byte) (int, uint64, bool, error){
+				"fst":    fst.LongestPrefix,
+				"reader": reader.LongestPrefix,
+			} {
+				l, val, found, err := longestPrefix([]byte(test.input))
+				if err != nil || !found || l != test.longest.Len || val != test.longest.Val {
+					t.Errorf("version %d %s: expected longest prefix of %q %v, got %d %d %t %v",
+						ver, name, test.input, test.longest, l, val, found, err)
+				}
+			}
+			for name, prefixesOf := range map[string]func([]byte) ([]PrefixMatch, error){
+				"fst":    fst.PrefixesOf,
+				"reader": reader.PrefixesOf,
+			} {
+				prefixes, err := prefixesOf([]byte(test.input))
+				if err != nil || !reflect.DeepEqual(prefixes, test.prefixes) {
+					t.Errorf("version %d %s: expected prefixes of %q %v, got %v %v",
+						ver, name, test.input, test.prefixes, prefixes, err)
+				}
+			}
+		}
+	}
+}
+
+func TestLongestPrefixNotFound(t *testing.T) {
+	fst, err := Load(buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}, []string{"abc", "abd"}, []uint64{1, 2}))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	for _, input := range []string{"", "ab", "abx", "b"} {
+		_, _, found, err := fst.LongestPrefix([]byte(input))
+		if err != nil || found {
+			t.Errorf("expected no prefix of %q, got %t %v", input, found, err)
+		}
+		prefixes, err := fst.PrefixesOf([]byte(input))
+		if err != nil || len(prefixes) != 0 {
+			t.Errorf("expected no prefixes of %q, got %v %v", input, prefixes, err)
+		}
+	}
+}
+
+func TestLongestPrefixNoAllocs(t *testing.T) {
+	fst, _, cleanup := openTestFST(t)
+	defer cleanup()
+	reader, err := fst.Reader()
+	if err != nil {
+		t.Fatalf("error creating reader: %v", err)
+	}
+
+	input := []byte(thousandTestWords[500] + "suffix")
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _, _, _ = fst.LongestPrefix(input)
+		_, _, _, _ = reader.LongestPrefix(input)
+		_, _ = reader.PrefixesOf(input)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %f", allocs)
+	}
+}
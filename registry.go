@@ -24,6 +24,13 @@ type registry struct {
 	table           []registryCell
 	tableSize       uint
 	mruSize         uint
+
+	// exact is used instead of the table when the registry is unbounded,
+	// it holds every node registered, keyed by hash
+	exact map[uint64][]registryCell
+
+	hits   uint64
+	misses uint64
 }
 
 func newRegistry(p *builderNodePool, tableSize, mruSize int) *registry {
@@ -37,15 +44,45 @@ func newRegistry(p *builderNodePool, tableSize, mruSize int) *registry {
 	return rv
 }
 
+// newExactRegistry returns a registry which never forgets a node, so
+// every equivalent node is found, at the cost of unbounded memory.
+func newExactRegistry(p *builderNodePool) *registry {
+	return &registry{
+		builderNodePool: p,
+		exact:           map[uint64][]registryCell{},
+	}
+}
+
 func (r *registry) Reset() {
 	var empty registryCell
 	for i := range r.table {
 		r.builderNodePool.Put(r.table[i].node)
 		r.table[i] = empty
 	}
+	for h, cells := range r.exact {
+		for i := range cells {
+			r.builderNodePool.Put(cells[i].node)
+		}
+		delete(r.exact, h)
+	}
+	r.hits = 0
+	r.misses = 0
 }
 
 func (r *registry) entry(node *builderNode) (bool, int, *registryCell) {
+	found, addr, cell := r.lookup(node)
+	if found {
+		r.hits++
+	} else {
+		r.misses++
+	}
+	return found, addr, cell
+}
+
+func (r *registry) lookup(node *builderNode) (bool, int, *registryCell) {
+	if r.exact != nil {
+		return r.exactEntry(node)
+	}
 	if len(r.table) == 0 {
 		return false, 0, nil
 	}
@@ -56,9 +93,28 @@ func (r *registry) entry(node *builderNode) (bool, int, *registryCell) {
 	return rc.entry(node, r.builderNodePool)
 }
 
+// exactEntry returns the cell for the node, the returned cell is only
+// valid until the next call.
+func (r *registry) exactEntry(node *builderNode) (bool, int, *registryCell) {
+	h := hashNode(node)
+	cells := r.exact[h]
+	for i := range cells {
+		if cells[i].node.equiv(node) {
+			return true, cells[i].addr, nil
+		}
+	}
+	cells = append(cells, registryCell{node: node})
+	r.exact[h] = cells
+	return false, 0, &cells[len(cells)-1]
+}
+
 const fnvPrime = 1099511628211
 
 func (r *registry) hash(b *builderNode) int {
+	return int(hashNode(b) % uint64(r.tableSize))
+}
+
+func hashNode(b *builderNode) uint64 {
 	var final uint64
 	if b.final {
 		final = 1
@@ -72,7 +128,7 @@ func (r *registry) hash(b *builderNode) int {
 		h = (h ^ t.out) * fnvPrime
 		h = (h ^ uint64(t.addr)) * fnvPrime
 	}
-	return int(h % uint64(r.tableSize))
+	return h
 }
 
 type registryCache []registryCell
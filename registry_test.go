@@ -14,7 +14,12 @@
 
 package vellum
 
-import "testing"
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+)
 
 // FIXME add tests for MRU
 
@@ -57,3 +62,148 @@ func TestRegistry(t *testing.T) {
 		t.Errorf("expected to get addr 276, got %d", nowAddr)
 	}
 }
+
+func TestExactRegistry(t *testing.T) {
+	p := &builderNodePool{}
+	r := newExactRegistry(p)
+
+	var cells []*registryCell
+	for i := 0; i < 100; i++ {
+		n := &builderNode{
+			trans: []transition{{in: byte(i), addr: i + 2}},
+		}
+		found, _, cell := r.entry(n)
+		if found {
+			t.Fatalf("expected node %d not found", i)
+		}
+		cell.addr = 1000 + i
+		cells = append(cells, cell)
+	}
+	for i := 0; i < 100; i++ {
+		n := &builderNode{
+			trans: []transition{{in: byte(i), addr: i + 2}},
+		}
+		found, addr, _ := r.entry(n)
+		if !found || addr != 1000+i {
+			t.Errorf("expected node %d found at %d, got %t %d", i, 1000+i, found, addr)
+		}
+	}
+	if r.hits != 100 || r.misses != 100 {
+		t.Errorf("expected 100 hits and misses, got %d %d", r.hits, r.misses)
+	}
+
+	r.Reset()
+	if len(r.exact) != 0 || r.hits != 0 || r.misses != 0 {
+		t.Errorf("expected empty registry after reset")
+	}
+}
+
+// duplicateStates returns the number of states reachable in the FST which
+// are equivalent to another reachable state, which is zero for a minimal FST
+func duplicateStates(t *testing.T, data []byte) int {
+	fst, err := Load(data)
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	seen := map[int]bool{}
+	sigs := map[string]int{}
+	var dups int
+	stack := []int{fst.decoder.getRoot()}
+	for len(stack) > 0 {
+		addr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[addr] || addr == emptyAddr {
+			continue
+		}
+		seen[addr] = true
+		state, err := fst.decoder.stateAt(addr, nil)
+		if err != nil {
+			t.Fatalf("error decoding state %d: %v", addr, err)
+		}
+		var sig bytes.Buffer
+		fmt.Fprintf(&sig, "%t/%d", state.Final(), state.FinalOutput())
+		for i := 0; i < state.NumTransitions(); i++ {
+			in := state.TransitionAt(i)
+			_, dest, out := state.TransitionFor(in)
+			fmt.Fprintf(&sig, " %d:%d/%d", in, dest, out)
+			stack = append(stack, dest)
+		}
+		sigs[sig.String()]++
+		if sigs[sig.String()] > 1 {
+			dups++
+		}
+	}
+	return dups
+}
+
+func TestRegistryExactMinimal(t *testing.T) {
+	keys := append([]string(nil), thousandTestWords...)
+	sort.Strings(keys)
+	vals := make([]uint64, len(keys))
+
+	small := buildTestFST(t, &BuilderOpts{
+		Encoder:           1,
+		RegistryTableSize: 1,
+		RegistryMRUSize:   1,
+	}, keys, vals)
+	if duplicateStates(t, small) == 0 {
+		t.Fatalf("expected duplicate states with a tiny registry")
+	}
+
+	exact := buildTestFST(t, &BuilderOpts{
+		Encoder:       1,
+		RegistryExact: true,
+	}, keys, vals)
+	if dups := duplicateStates(t, exact); dups != 0 {
+		t.Errorf("expected no duplicate states with exact registry, got %d", dups)
+	}
+	if len(exact) >= len(small) {
+		t.Errorf("expected exact fst smaller than %d, got %d", len(small), len(exact))
+	}
+
+	fst, err := Load(exact)
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	for _, key := range keys {
+		ok, err := fst.Contains([]byte(key))
+		if err != nil || !ok {
+			t.Errorf("expected %s found, got %t %v", key, ok, err)
+		}
+	}
+}
+
+func TestBuilderRegistryStats(t *testing.T) {
+	var buf bytes.Buffer
+	b, err := New(&buf, &BuilderOpts{
+		Encoder:       1,
+		RegistryExact: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the states after "b" and "c" (and after "ba" and "ca") are shared
+	for _, key := range []string{"bat", "cat"} {
+		err = b.Insert([]byte(key), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := b.Stats()
+	if stats.RegistryHits != 2 || stats.RegistryMisses != 3 {
+		t.Errorf("expected 2 registry hits and 3 misses, got %+v", stats)
+	}
+
+	err = b.Reset(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats = b.Stats()
+	if stats.RegistryHits != 0 || stats.RegistryMisses != 0 {
+		t.Errorf("expected zero registry stats after reset, got %+v", stats)
+	}
+}
@@ -0,0 +1,326 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// estimateWalks is the number of random walks (or samples) EstimateCount
+// uses when the count can not be computed exactly
+const estimateWalks = 256
+
+// AnnotateCounts computes, and keeps in memory, the number of keys
+// reachable from each state of the FST.  The encoding does not store
+// these counts, computing them visits every state once.  With them,
+// EstimateCount is exact (when no automaton is used) and Sample is
+// possible.
+func (f *FST) AnnotateCounts() error {
+	err := f.rlock()
+	if err != nil {
+		return err
+	}
+	defer f.mu.RUnlock()
+	_, err = f.annotateCounts()
+	return err
+}
+
+// annotateCounts returns the counts, computing them if needed, the read
+// lock must be held.
+func (f *FST) annotateCounts() (map[int]uint64, error) {
+	if counts, ok := f.counts.Load().(map[int]uint64); ok {
+		return counts, nil
+	}
+
+	// visit every state, then count lowest address first, so that all
+	// destinations have already been counted
+	var addrs []int
+	seen := map[int]struct{}{}
+	stack := addrStack{f.decoder.getRoot()}
+	var addr int
+	for len(stack) > 0 {
+		stack, addr = stack.Pop()
+		if _, ok := seen[addr]; ok || addr == emptyAddr || addr == noneAddr {
+			continue
+		}
+		seen[addr] = struct{}{}
+		addrs = append(addrs, addr)
+		state, err := f.decoder.stateAt(addr, nil)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < state.NumTransitions(); i++ {
+			_, dest, _ := state.TransitionFor(state.TransitionAt(i))
+			stack = append(stack, dest)
+		}
+	}
+	sort.Ints(addrs)
+
+	counts := make(map[int]uint64, len(addrs)+1)
+	counts[emptyAddr] = 1
+	state := &fstStateV1{}
+	for _, addr = range addrs {
+		_, err := f.decoder.stateAt(addr, state)
+		if err != nil {
+			return nil, err
+		}
+		var count uint64
+		if state.Final() {
+			count++
+		}
+		for i := 0; i < state.NumTransitions(); i++ {
+			_, dest, _ := state.TransitionFor(state.TransitionAt(i))
+			count += counts[dest]
+		}
+		counts[addr] = count
+	}
+	f.counts.Store(counts)
+	return counts, nil
+}
+
+// EstimateCount estimates the number of keys between the provided
+// startKeyInclusive and endKeyExclusive which also satisfy the automaton
+// (nil means all of them), without visiting them.  If AnnotateCounts has
+// been called, the number of keys in the range is exact, and an automaton
+// is applied to a uniform sample of them.  Otherwise the estimate is the
+// average of random walks from the root, following only transitions
+// within the range that the automaton can match, each weighted by the
+// product of the number of choices made.  The walks are seeded the same
+// way every time, so the estimate for a given FST and query is stable.
+func (f *FST) EstimateCount(startKeyInclusive, endKeyExclusive []byte,
+	aut Automaton) (int, error) {
+	err := f.rlock()
+	if err != nil {
+		return 0, err
+	}
+	defer f.mu.RUnlock()
+
+	rng := rand.New(rand.NewSource(1))
+	if counts, ok := f.counts.Load().(map[int]uint64); ok {
+		return f.estimateCountAnnotated(counts, startKeyInclusive,
+			endKeyExclusive, aut, rng)
+	}
+	if aut == nil {
+		aut = alwaysMatchAutomaton
+	}
+
+	var total float64
+	for i := 0; i < estimateWalks; i++ {
+		est, err := f.randomWalk(startKeyInclusive, endKeyExclusive, aut, rng)
+		if err != nil {
+			return 0, err
+		}
+		total += est
+	}
+	return int(total/estimateWalks + 0.5), nil
+}
+
+func (f *FST) estimateCountAnnotated(counts map[int]uint64,
+	startKeyInclusive, endKeyExclusive []byte, aut Automaton,
+	rng *rand.Rand) (int, error) {
+	start, err := f.rank(counts, startKeyInclusive)
+	if err != nil {
+		return 0, err
+	}
+	end := uint64(f.len)
+	if endKeyExclusive != nil {
+		end, err = f.rank(counts, endKeyExclusive)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if end <= start {
+		return 0, nil
+	}
+	if aut == nil {
+		return int(end - start), nil
+	}
+
+	var matches int
+	var key []byte
+	for i := 0; i < estimateWalks; i++ {
+		key, err = f.selectKey(counts, start+uint64(rng.Int63n(int64(end-start))), key[:0])
+		if err != nil {
+			return 0, err
+		}
+		if AutomatonContains(aut, key) {
+			matches++
+		}
+	}
+	return int(float64(end-start)*float64(matches)/estimateWalks + 0.5), nil
+}
+
+// randomWalk returns one estimate of the number of keys in the range which
+// the automaton matches.
+func (f *FST) randomWalk(startKeyInclusive, endKeyExclusive []byte,
+	aut Automaton, rng *rand.Rand) (float64, error) {
+	state, err := f.decoder.stateAt(f.decoder.getRoot(), nil)
+	if err != nil {
+		return 0, err
+	}
+	autState := aut.Start()
+
+	// while the path so far equals a prefix of the start (or end) key,
+	// the next transition is constrained by it
+	onStart := len(startKeyInclusive) > 0
+	onEnd := endKeyExclusive != nil
+	weight := 1.0
+	var est float64
+	var choices []byte
+	var autChoices []int
+	for depth := 0; ; depth++ {
+		if onStart && depth == len(startKeyInclusive) {
+			onStart = false // equal to the start key, so all keys below are in range
+		}
+		if onEnd && depth == len(endKeyExclusive) {
+			break // equal to the end key, so all keys below are out of range
+		}
+		if !onStart && state.Final() && aut.IsMatch(autState) {
+			est += weight
+		}
+
+		choices = choices[:0]
+		autChoices = autChoices[:0]
+		for i := 0; i < state.NumTransitions(); i++ {
+			t := state.TransitionAt(i)
+			if onStart && t < startKeyInclusive[depth] ||
+				onEnd && t > endKeyExclusive[depth] {
+				continue
+			}
+			if onEnd && t == endKeyExclusive[depth] &&
+				depth+1 == len(endKeyExclusive) {
+				continue // every key below is greater than or equal to the end
+			}
+			next := aut.Accept(autState, t)
+			if !aut.CanMatch(next) {
+				continue
+			}
+			choices = append(choices, t)
+			autChoices = append(autChoices, next)
+		}
+		if len(choices) == 0 {
+			break
+		}
+
+		choice := rng.Intn(len(choices))
+		t := choices[choice]
+		weight *= float64(len(choices))
+		onStart = onStart && t == startKeyInclusive[depth]
+		onEnd = onEnd && t == endKeyExclusive[depth]
+		autState = autChoices[choice]
+		_, next, _ := state.TransitionFor(t)
+		state, err = f.decoder.stateAt(next, state)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return est, nil
+}
+
+// rank returns the number of keys less than the key.
+func (f *FST) rank(counts map[int]uint64, key []byte) (uint64, error) {
+	var rv uint64
+	state, err := f.decoder.stateAt(f.decoder.getRoot(), nil)
+	if err != nil {
+		return 0, err
+	}
+	for depth := 0; depth < len(key); depth++ {
+		if state.Final() {
+			rv++ // key[:depth] is less than the key
+		}
+		for i := 0; i < state.NumTransitions(); i++ {
+			t := state.TransitionAt(i)
+			if t >= key[depth] {
+				break
+			}
+			_, dest, _ := state.TransitionFor(t)
+			rv += counts[dest]
+		}
+		_, next, _ := state.TransitionFor(key[depth])
+		if next == noneAddr {
+			break
+		}
+		state, err = f.decoder.stateAt(next, state)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return rv, nil
+}
+
+// selectKey appends the key with the provided rank to the key.
+func (f *FST) selectKey(counts map[int]uint64, rank uint64,
+	key []byte) ([]byte, error) {
+	state, err := f.decoder.stateAt(f.decoder.getRoot(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if state.Final() {
+			if rank == 0 {
+				return key, nil
+			}
+			rank--
+		}
+		next := noneAddr
+		for i := 0; i < state.NumTransitions(); i++ {
+			t := state.TransitionAt(i)
+			_, dest, _ := state.TransitionFor(t)
+			if rank < counts[dest] {
+				key = append(key, t)
+				next = dest
+				break
+			}
+			rank -= counts[dest]
+		}
+		if next == noneAddr {
+			return nil, fmt.Errorf("no key with rank %d", rank)
+		}
+		state, err = f.decoder.stateAt(next, state)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Sample returns n keys chosen uniformly at random (with replacement) from
+// the keys of the FST, in the order they were chosen.  It requires the
+// counts of AnnotateCounts, which are computed if they have not been
+// already.
+func (f *FST) Sample(n int, rng *rand.Rand) ([][]byte, error) {
+	err := f.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer f.mu.RUnlock()
+
+	if f.len == 0 || n <= 0 {
+		return nil, nil
+	}
+	counts, err := f.annotateCounts()
+	if err != nil {
+		return nil, err
+	}
+	rv := make([][]byte, n)
+	for i := range rv {
+		rv[i], err = f.selectKey(counts, uint64(rng.Int63n(int64(f.len))), nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rv, nil
+}
@@ -0,0 +1,189 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/couchbase/vellum/regexp"
+)
+
+// countRange counts the keys between start and end which the automaton
+// matches.
+func countRange(keys []string, start, end []byte, aut Automaton) int {
+	var rv int
+	for _, key := range keys {
+		if key >= string(start) && (end == nil || key < string(end)) &&
+			(aut == nil || AutomatonContains(aut, []byte(key))) {
+			rv++
+		}
+	}
+	return rv
+}
+
+func TestEstimateCountAnnotated(t *testing.T) {
+	fst, _, cleanup := openTestFST(t)
+	defer cleanup()
+	err := fst.AnnotateCounts()
+	if err != nil {
+		t.Fatalf("error annotating: %v", err)
+	}
+
+	ranges := [][2][]byte{
+		{nil, nil},
+		{[]byte("b"), []byte("d")},
+		{[]byte("c"), nil},
+		{nil, []byte("c")},
+		{[]byte(thousandTestWords[10]), []byte(thousandTestWords[20])},
+		{[]byte(thousandTestWords[10] + "\x00"), []byte(thousandTestWords[20] + "\x00")},
+		{[]byte("z"), nil},
+		{[]byte("d"), []byte("b")},
+	}
+	for _, r := range ranges {
+		count, err := fst.EstimateCount(r[0], r[1], nil)
+		if err != nil {
+			t.Fatalf("error estimating: %v", err)
+		}
+		expected := countRange(thousandTestWords, r[0], r[1], nil)
+		if count != expected {
+			t.Errorf("%q-%q: expected exactly %d, got %d", r[0], r[1], expected, count)
+		}
+	}
+
+	// with an automaton, the estimate is based on a sample of the range
+	re, err := regexp.New("s.*")
+	if err != nil {
+		t.Fatalf("error compiling regexp: %v", err)
+	}
+	count, err := fst.EstimateCount(nil, nil, re)
+	if err != nil {
+		t.Fatalf("error estimating: %v", err)
+	}
+	expected := countRange(thousandTestWords, nil, nil, re)
+	if count < expected/2 || count > expected*2 {
+		t.Errorf("expected about %d, got %d", expected, count)
+	}
+}
+
+func TestEstimateCountRandomWalk(t *testing.T) {
+	// every path from the root branches the same way, so each walk
+	// estimates exactly
+	var keys []string
+	for a := 'a'; a <= 'z'; a++ {
+		for b := 'a'; b <= 'j'; b++ {
+			keys = append(keys, string([]rune{a, b}))
+		}
+	}
+	fst, err := Load(buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}, keys, randomValues(keys)))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	re, err := regexp.New(".[a-c]")
+	if err != nil {
+		t.Fatalf("error compiling regexp: %v", err)
+	}
+	tests := []struct {
+		start, end []byte
+		aut        Automaton
+	}{
+		{nil, nil, nil},
+		{[]byte("c"), []byte("f"), nil},
+		{nil, nil, re},
+	}
+	for _, test := range tests {
+		count, err := fst.EstimateCount(test.start, test.end, test.aut)
+		if err != nil {
+			t.Fatalf("error estimating: %v", err)
+		}
+		expected := countRange(keys, test.start, test.end, test.aut)
+		if count != expected {
+			t.Errorf("%q-%q: expected %d, got %d", test.start, test.end, expected, count)
+		}
+	}
+
+	// less regular, only roughly
+	words, _, cleanup := openTestFST(t)
+	defer cleanup()
+	for _, r := range [][2][]byte{{nil, nil}, {[]byte("m"), []byte("t")}} {
+		count, err := words.EstimateCount(r[0], r[1], nil)
+		if err != nil {
+			t.Fatalf("error estimating: %v", err)
+		}
+		expected := countRange(thousandTestWords, r[0], r[1], nil)
+		if count < expected/2 || count > expected*2 {
+			t.Errorf("%q-%q: expected about %d, got %d", r[0], r[1], expected, count)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	keys := []string{"a", "ab", "abc", "b", "bcd"}
+	fst, err := Load(buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}, keys, randomValues(keys)))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+
+	samples, err := fst.Sample(5000, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("error sampling: %v", err)
+	}
+	if len(samples) != 5000 {
+		t.Fatalf("expected 5000 samples, got %d", len(samples))
+	}
+	counts := map[string]int{}
+	for _, sample := range samples {
+		counts[string(sample)]++
+	}
+	var got []string
+	for key, count := range counts {
+		got = append(got, key)
+		if count < 800 || count > 1200 {
+			t.Errorf("expected about 1000 samples of %q, got %d", key, count)
+		}
+	}
+	sort.Strings(got)
+	if len(got) != len(keys) {
+		t.Errorf("expected samples of %v, got %v", keys, got)
+	}
+}
+
+func TestSampleEmpty(t *testing.T) {
+	fst, err := Load(buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}, nil, nil))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	samples, err := fst.Sample(10, rand.New(rand.NewSource(1)))
+	if err != nil || len(samples) != 0 {
+		t.Errorf("expected no samples, got %v %v", samples, err)
+	}
+	count, err := fst.EstimateCount(nil, nil, nil)
+	if err != nil || count != 0 {
+		t.Errorf("expected count 0, got %d %v", count, err)
+	}
+}
@@ -0,0 +1,129 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+// ScanMode selects which occurrences of keys a Scanner reports.
+type ScanMode int
+
+const (
+	// ScanLongest segments the text leftmost-longest, at each position the
+	// longest key starting there is reported and scanning resumes after
+	// it, so the matches never overlap.
+	ScanLongest ScanMode = iota
+
+	// ScanAll reports every occurrence of every key, including those which
+	// overlap or are contained in other matches.
+	ScanAll
+)
+
+// ScanMatch describes an occurrence of a key in the text scanned, the key
+// is text[Start:End].
+type ScanMatch struct {
+	Start int
+	End   int
+	Val   uint64
+}
+
+// A Scanner finds the keys of an FST (for example a dictionary of terms)
+// occurring anywhere in a text.  Each position of the text is matched
+// against the FST directly, so the cost is proportional to the length of
+// the text times the length of the matches.  The empty key, if present,
+// never matches.  Like a Reader, a Scanner is meant for single threaded
+// use.
+type Scanner struct {
+	f        *FST
+	mode     ScanMode
+	prealloc fstStateV1
+	prefixes []PrefixMatch
+}
+
+// NewScanner returns a Scanner for the keys of the FST.
+func NewScanner(f *FST, mode ScanMode) *Scanner {
+	return &Scanner{
+		f:    f,
+		mode: mode,
+	}
+}
+
+// Scan calls the callback for each match in the text, in order of their
+// start (and then end) positions.  If the callback returns an error, the
+// scan stops and that error is returned.  The FST is only read locked
+// while the matches at each position are found, not while the callback
+// runs, so the callback may use the FST.  If the FST is closed during the
+// scan, ErrClosed is returned.
+func (s *Scanner) Scan(text []byte, callback func(ScanMatch) error) error {
+	for start := 0; start < len(text); {
+		prefixes, err := s.prefixesAt(text[start:])
+		if err != nil {
+			return err
+		}
+		if len(prefixes) == 0 {
+			start++
+			continue
+		}
+		if s.mode == ScanLongest {
+			prefixes = prefixes[len(prefixes)-1:]
+		}
+		for _, prefix := range prefixes {
+			err = callback(ScanMatch{
+				Start: start,
+				End:   start + prefix.Len,
+				Val:   prefix.Val,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if s.mode == ScanLongest {
+			start += prefixes[0].Len
+		} else {
+			start++
+		}
+	}
+	return nil
+}
+
+// prefixesAt returns the non-empty keys which are prefixes of the text,
+// shortest first, in a slice owned by the Scanner.
+func (s *Scanner) prefixesAt(text []byte) ([]PrefixMatch, error) {
+	err := s.f.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer s.f.mu.RUnlock()
+
+	s.prefixes, err = s.f.prefixesOf(text, &s.prealloc, s.prefixes[:0])
+	if err != nil {
+		return nil, err
+	}
+	prefixes := s.prefixes
+	if len(prefixes) > 0 && prefixes[0].Len == 0 {
+		prefixes = prefixes[1:]
+	}
+	return prefixes, nil
+}
+
+// FindAll returns all of the matches in the text, see Scan.
+func (s *Scanner) FindAll(text []byte) ([]ScanMatch, error) {
+	var rv []ScanMatch
+	err := s.Scan(text, func(m ScanMatch) error {
+		rv = append(rv, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
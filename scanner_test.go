@@ -0,0 +1,127 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestScanner(t *testing.T) {
+	keys := []string{"", "new", "new york", "new york city", "york", "yorkshire"}
+	vals := []uint64{0, 1, 2, 3, 4, 5}
+	fst, err := Load(buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}, keys, vals))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+
+	text := []byte("in new york city and new yorkshire")
+	tests := []struct {
+		mode     ScanMode
+		expected []ScanMatch
+	}{
+		{
+			mode: ScanLongest,
+			expected: []ScanMatch{
+				{3, 16, 3},  // new york city
+				{21, 29, 2}, // new york, there are no word boundaries
+			},
+		},
+		{
+			mode: ScanAll,
+			expected: []ScanMatch{
+				{3, 6, 1},   // new
+				{3, 11, 2},  // new york
+				{3, 16, 3},  // new york city
+				{7, 11, 4},  // york
+				{21, 24, 1}, // new
+				{21, 29, 2}, // new york
+				{25, 29, 4}, // york
+				{25, 34, 5}, // yorkshire
+			},
+		},
+	}
+	for _, test := range tests {
+		matches, err := NewScanner(fst, test.mode).FindAll(text)
+		if err != nil {
+			t.Fatalf("mode %d: error scanning: %v", test.mode, err)
+		}
+		if !reflect.DeepEqual(matches, test.expected) {
+			t.Errorf("mode %d: expected %v, got %v", test.mode, test.expected, matches)
+		}
+	}
+
+	matches, err := NewScanner(fst, ScanAll).FindAll([]byte("nothing here"))
+	if err != nil || len(matches) != 0 {
+		t.Errorf("expected no matches, got %v %v", matches, err)
+	}
+}
+
+func TestScannerCallbackError(t *testing.T) {
+	fst, err := Load(buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}, []string{"a"}, []uint64{1}))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+
+	stop := fmt.Errorf("stop")
+	var n int
+	err = NewScanner(fst, ScanLongest).Scan([]byte("aaaa"), func(ScanMatch) error {
+		n++
+		if n == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 2 {
+		t.Errorf("expected scan to stop after 2 matches, got %d %v", n, err)
+	}
+}
+
+func TestScannerCallbackUsesFST(t *testing.T) {
+	fst, err := Load(buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}, []string{"a", "b"}, []uint64{1, 2}))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+
+	// the callback may look up other keys, and even close the FST
+	var n int
+	err = NewScanner(fst, ScanLongest).Scan([]byte("abab"), func(m ScanMatch) error {
+		n++
+		val, ok, err := fst.Get([]byte("b"))
+		if err != nil || !ok || val != 2 {
+			t.Errorf("expected b -> 2, got %d %t %v", val, ok, err)
+		}
+		if n == 2 {
+			return fst.Close()
+		}
+		return nil
+	})
+	if err != ErrClosed || n != 2 {
+		t.Errorf("expected scan to stop with ErrClosed after 2 matches, got %d %v", n, err)
+	}
+}
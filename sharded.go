@@ -0,0 +1,495 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+const defaultShardSize = 1 << 20
+
+// ShardedBuilderOpts is a structure to let advanced users customize the
+// behavior of the ShardedBuilder.
+type ShardedBuilderOpts struct {
+	// BuilderOpts are used to build each shard, any Metadata is stored
+	// once in the container instead of in each shard, and Progress is
+	// not used.
+	BuilderOpts *BuilderOpts
+
+	// ShardSize is the number of keys in each shard, zero means the
+	// default (1M).
+	ShardSize int
+
+	// Workers is the number of shards built concurrently, zero means
+	// the default (GOMAXPROCS).
+	Workers int
+}
+
+// A ShardedBuilder builds a sharded FST in parallel.  The keys (which must
+// be inserted in lexicographic order, as with a Builder) are partitioned
+// into shards of consecutive keys, which are built concurrently and then
+// written in order to a container.  The result is read with a ShardedFST.
+type ShardedBuilder struct {
+	opts      BuilderOpts
+	shardSize int
+
+	c    *ContainerWriter
+	last []byte
+	curr *shardBatch
+	num  int
+
+	work     chan *shardBatch
+	results  chan *shardBatch
+	inflight chan struct{}
+	workers  sync.WaitGroup
+	writer   sync.WaitGroup
+
+	m      sync.Mutex
+	err    error
+	closed bool
+}
+
+// shardBatch holds the keys and values of one shard, and once built, the
+// FST data
+type shardBatch struct {
+	num  int
+	keys []byte
+	ends []int
+	vals []uint64
+	data bytes.Buffer
+	err  error
+}
+
+// NewShardedBuilder returns a new ShardedBuilder which will write the
+// container of shards to the provided Writer.
+func NewShardedBuilder(w io.Writer, opts *ShardedBuilderOpts) (*ShardedBuilder, error) {
+	if opts == nil {
+		opts = &ShardedBuilderOpts{}
+	}
+	rv := &ShardedBuilder{
+		shardSize: opts.ShardSize,
+	}
+	if opts.BuilderOpts != nil {
+		rv.opts = *opts.BuilderOpts
+	} else {
+		rv.opts = *defaultBuilderOpts
+	}
+	if rv.shardSize <= 0 {
+		rv.shardSize = defaultShardSize
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	// the metadata is stored in the container, not in the shards
+	meta := rv.opts.Metadata
+	rv.opts.Metadata = nil
+	rv.opts.Progress = nil
+
+	// check the builder options of the shards before starting
+	_, err := New(ioutil.Discard, &rv.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rv.c, err = NewContainerWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range meta {
+		rv.c.SetMetadata(k, v)
+	}
+
+	rv.work = make(chan *shardBatch, workers)
+	rv.results = make(chan *shardBatch, workers)
+	rv.inflight = make(chan struct{}, 2*workers)
+	rv.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go rv.buildShards()
+	}
+	rv.writer.Add(1)
+	go rv.writeShards()
+	return rv, nil
+}
+
+// Insert the provided value to the set being built.
+// NOTE: values must be inserted in lexicographical order.
+func (b *ShardedBuilder) Insert(key []byte, val uint64) error {
+	if err := b.getErr(); err != nil {
+		return err
+	}
+	if b.closed {
+		return fmt.Errorf("sharded builder closed")
+	}
+	if b.curr != nil && bytes.Compare(key, b.last) < 0 {
+		return ErrOutOfOrder
+	}
+	// a shard is only finished between distinct keys, so that equal keys
+	// are always in the same shard
+	if b.curr != nil && len(b.curr.vals) >= b.shardSize && !bytes.Equal(key, b.last) {
+		b.dispatch()
+	}
+	if b.curr == nil {
+		b.curr = &shardBatch{
+			num:  b.num,
+			ends: make([]int, 0, b.shardSize),
+			vals: make([]uint64, 0, b.shardSize),
+		}
+		b.num++
+	}
+	b.curr.keys = append(b.curr.keys, key...)
+	b.curr.ends = append(b.curr.ends, len(b.curr.keys))
+	b.curr.vals = append(b.curr.vals, val)
+	b.last = b.curr.keys[len(b.curr.keys)-len(key):]
+	return nil
+}
+
+func (b *ShardedBuilder) dispatch() {
+	b.inflight <- struct{}{}
+	b.work <- b.curr
+	b.curr = nil
+}
+
+func (b *ShardedBuilder) getErr() error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.err
+}
+
+func (b *ShardedBuilder) setErr(err error) {
+	b.m.Lock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.m.Unlock()
+}
+
+func (b *ShardedBuilder) buildShards() {
+	defer b.workers.Done()
+	var builder *Builder
+	for batch := range b.work {
+		// there is no point building a shard once another has failed
+		batch.err = b.getErr()
+		if batch.err == nil {
+			builder, batch.err = b.buildShard(builder, batch)
+		}
+		// release the keys before waiting for the shard to be written
+		batch.keys, batch.ends, batch.vals = nil, nil, nil
+		b.results <- batch
+	}
+}
+
+// buildShard builds the FST for the batch, reusing the builder if possible
+func (b *ShardedBuilder) buildShard(builder *Builder, batch *shardBatch) (*Builder, error) {
+	var err error
+	if builder == nil {
+		builder, err = New(&batch.data, &b.opts)
+	} else {
+		err = builder.Reset(&batch.data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var start int
+	for i := range batch.vals {
+		err = builder.Insert(batch.keys[start:batch.ends[i]], batch.vals[i])
+		if err != nil {
+			return nil, err
+		}
+		start = batch.ends[i]
+	}
+	return builder, builder.Close()
+}
+
+// writeShards writes the built shards to the container in order
+func (b *ShardedBuilder) writeShards() {
+	defer b.writer.Done()
+	pending := map[int]*shardBatch{}
+	next := 0
+	for batch := range b.results {
+		pending[batch.num] = batch
+		for pending[next] != nil {
+			batch = pending[next]
+			delete(pending, next)
+			next++
+			err := batch.err
+			if err == nil {
+				err = b.writeShard(batch)
+			}
+			if err != nil {
+				b.setErr(err)
+			}
+			<-b.inflight
+		}
+	}
+}
+
+func (b *ShardedBuilder) writeShard(batch *shardBatch) error {
+	if b.getErr() != nil {
+		return nil
+	}
+	w, err := b.c.Create(fmt.Sprintf("shard-%08d", batch.num))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(batch.data.Bytes())
+	return err
+}
+
+// Close MUST be called after inserting all values, it waits for all of the
+// shards to be built and written, and then writes out the container.
+func (b *ShardedBuilder) Close() error {
+	if b.closed {
+		return b.getErr()
+	}
+	b.closed = true
+	if b.curr != nil {
+		b.dispatch()
+	}
+	close(b.work)
+	b.workers.Wait()
+	close(b.results)
+	b.writer.Wait()
+	if err := b.getErr(); err != nil {
+		return err
+	}
+	err := b.c.Close()
+	if err != nil {
+		b.setErr(err)
+	}
+	return err
+}
+
+// ShardedFST is a read-only view of a sharded FST built by a
+// ShardedBuilder.  The shards contain disjoint ranges of keys, in order.
+type ShardedFST struct {
+	c       *Container
+	shards  []*FST
+	minKeys [][]byte
+	len     int
+}
+
+// OpenSharded loads the sharded FST stored in the provided path.
+func OpenSharded(path string) (*ShardedFST, error) {
+	c, err := OpenContainer(path)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := newShardedFST(c)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return rv, nil
+}
+
+// LoadSharded will return the sharded FST represented by the provided
+// byte slice.
+func LoadSharded(data []byte) (*ShardedFST, error) {
+	c, err := LoadContainer(data)
+	if err != nil {
+		return nil, err
+	}
+	return newShardedFST(c)
+}
+
+func newShardedFST(c *Container) (*ShardedFST, error) {
+	rv := &ShardedFST{
+		c: c,
+	}
+	var lastMax []byte
+	for _, name := range c.Names() {
+		fst, err := c.FST(name)
+		if err != nil {
+			return nil, err
+		}
+		if fst.Len() == 0 {
+			continue
+		}
+		minKey, err := fst.GetMinKey()
+		if err != nil {
+			return nil, err
+		}
+		if lastMax != nil && bytes.Compare(minKey, lastMax) <= 0 {
+			return nil, fmt.Errorf("shard '%s' overlaps the previous shard", name)
+		}
+		lastMax, err = fst.GetMaxKey()
+		if err != nil {
+			return nil, err
+		}
+		rv.shards = append(rv.shards, fst)
+		rv.minKeys = append(rv.minKeys, minKey)
+		rv.len += fst.Len()
+	}
+	return rv, nil
+}
+
+// shardFor returns the index of the shard which could contain the key,
+// or -1 if the key is before all shards.
+func (s *ShardedFST) shardFor(key []byte) int {
+	return sort.Search(len(s.minKeys), func(i int) bool {
+		return bytes.Compare(s.minKeys[i], key) > 0
+	}) - 1
+}
+
+// Contains returns true if this sharded FST contains the specified key.
+func (s *ShardedFST) Contains(key []byte) (bool, error) {
+	_, exists, err := s.Get(key)
+	return exists, err
+}
+
+// Get returns the value associated with the key.  NOTE: a value of zero
+// does not imply the key does not exist, you must consult the second
+// return value as well.
+func (s *ShardedFST) Get(key []byte) (uint64, bool, error) {
+	i := s.shardFor(key)
+	if i < 0 {
+		return 0, false, nil
+	}
+	return s.shards[i].Get(key)
+}
+
+// Len returns the number of entries in this sharded FST instance.
+func (s *ShardedFST) Len() int {
+	return s.len
+}
+
+// NumShards returns the number of (non-empty) shards.
+func (s *ShardedFST) NumShards() int {
+	return len(s.shards)
+}
+
+// Metadata returns the user metadata stored by the ShardedBuilder.
+func (s *ShardedFST) Metadata() map[string][]byte {
+	keys := s.c.MetadataKeys()
+	if len(keys) == 0 {
+		return nil
+	}
+	rv := make(map[string][]byte, len(keys))
+	for _, k := range keys {
+		rv[k], _ = s.c.Metadata(k)
+	}
+	return rv
+}
+
+// Iterator returns a new ShardedIterator over all of the shards, starting
+// at the specified key (inclusive) and ending at the specified key
+// (exclusive).  A nil start or end means unbounded.
+func (s *ShardedFST) Iterator(startKeyInclusive, endKeyExclusive []byte) (*ShardedIterator, error) {
+	rv := &ShardedIterator{
+		s:                 s,
+		startKeyInclusive: startKeyInclusive,
+		endKeyExclusive:   endKeyExclusive,
+		itr:               &FSTIterator{},
+	}
+	err := rv.Seek(startKeyInclusive)
+	if err != nil {
+		return rv, err
+	}
+	return rv, nil
+}
+
+// Close will unmap any mmap'd data (if managed by vellum) and it will close
+// the backing file (if managed by vellum).
+func (s *ShardedFST) Close() error {
+	return s.c.Close()
+}
+
+// ShardedIterator iterates the key/value pairs of all of the shards of a
+// ShardedFST in lexicographic order.
+type ShardedIterator struct {
+	s                 *ShardedFST
+	startKeyInclusive []byte
+	endKeyExclusive   []byte
+
+	shard int
+	itr   *FSTIterator
+}
+
+// Current returns the key and value currently pointed to by the iterator.
+// If the iterator is not pointing at a valid value (because Iterator/Next/Seek)
+// returned an error previously, it may return nil,0.
+func (i *ShardedIterator) Current() ([]byte, uint64) {
+	if i.shard >= len(i.s.shards) {
+		return nil, 0
+	}
+	return i.itr.Current()
+}
+
+// Next advances this iterator to the next key/value pair.  If there is none,
+// then ErrIteratorDone is returned.
+func (i *ShardedIterator) Next() error {
+	if i.shard >= len(i.s.shards) {
+		return ErrIteratorDone
+	}
+	err := i.itr.Next()
+	if err == ErrIteratorDone {
+		return i.nextShard()
+	}
+	return err
+}
+
+// nextShard moves to the start of the next shard within range
+func (i *ShardedIterator) nextShard() error {
+	for i.shard++; i.shard < len(i.s.shards); i.shard++ {
+		if i.endKeyExclusive != nil &&
+			bytes.Compare(i.s.minKeys[i.shard], i.endKeyExclusive) >= 0 {
+			break
+		}
+		err := i.itr.Reset(i.s.shards[i.shard], i.startKeyInclusive, i.endKeyExclusive, nil)
+		if err != ErrIteratorDone {
+			return err
+		}
+	}
+	i.shard = len(i.s.shards)
+	return ErrIteratorDone
+}
+
+// Seek advances this iterator to the specified key/value pair.  If this key
+// is not in the FST, Current() will return the next largest key.  If this
+// seek operation would go past the last key, or outside the configured
+// startKeyInclusive/endKeyExclusive then ErrIteratorDone is returned.
+func (i *ShardedIterator) Seek(key []byte) error {
+	if bytes.Compare(key, i.startKeyInclusive) < 0 {
+		key = i.startKeyInclusive
+	}
+	i.shard = i.s.shardFor(key)
+	if i.shard < 0 {
+		i.shard = 0
+	}
+	if i.shard >= len(i.s.shards) {
+		return ErrIteratorDone
+	}
+	err := i.itr.Reset(i.s.shards[i.shard], i.startKeyInclusive, i.endKeyExclusive, nil)
+	if err == nil {
+		err = i.itr.Seek(key)
+	}
+	if err == ErrIteratorDone {
+		return i.nextShard()
+	}
+	return err
+}
+
+// Close will free any resources held by this iterator.
+func (i *ShardedIterator) Close() error {
+	return nil
+}
@@ -0,0 +1,360 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func buildSharded(t *testing.T, opts *ShardedBuilderOpts, keys []string, vals []uint64) []byte {
+	var buf bytes.Buffer
+	b, err := NewShardedBuilder(&buf, opts)
+	if err != nil {
+		t.Fatalf("error creating sharded builder: %v", err)
+	}
+	for i := range keys {
+		err = b.Insert([]byte(keys[i]), vals[i])
+		if err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatalf("error closing: %v", err)
+	}
+	return buf.Bytes()
+}
+
+type keyVal struct {
+	key string
+	val uint64
+}
+
+// kvIterator is the subset of Iterator needed to collect the key/values
+type kvIterator interface {
+	Current() ([]byte, uint64)
+	Next() error
+}
+
+func collectIterator(t *testing.T, itr kvIterator, err error) []keyVal {
+	var rv []keyVal
+	for err == nil {
+		key, val := itr.Current()
+		rv = append(rv, keyVal{string(key), val})
+		err = itr.Next()
+	}
+	if err != ErrIteratorDone {
+		t.Fatalf("iterator error: %v", err)
+	}
+	return rv
+}
+
+func TestShardedMatchesSerial(t *testing.T) {
+	keys := append([]string{""}, thousandTestWords...)
+	sort.Strings(keys)
+	vals := randomValues(keys)
+
+	serial, err := Load(buildTestFST(t, nil, keys, vals))
+	if err != nil {
+		t.Fatalf("error loading serial fst: %v", err)
+	}
+
+	for _, shardSize := range []int{1, 7, 100, 5000} {
+		sharded, err := LoadSharded(buildSharded(t, &ShardedBuilderOpts{
+			ShardSize: shardSize,
+			Workers:   4,
+		}, keys, vals))
+		if err != nil {
+			t.Fatalf("shard size %d: error loading: %v", shardSize, err)
+		}
+		wantShards := (len(keys) + shardSize - 1) / shardSize
+		if sharded.NumShards() != wantShards {
+			t.Errorf("shard size %d: expected %d shards, got %d",
+				shardSize, wantShards, sharded.NumShards())
+		}
+		if sharded.Len() != serial.Len() {
+			t.Errorf("shard size %d: expected len %d, got %d",
+				shardSize, serial.Len(), sharded.Len())
+		}
+
+		// lookups of every key, and of keys just before and after
+		for _, key := range keys {
+			for _, probe := range []string{key, key + "\x00", key + "zz", key[:len(key)/2]} {
+				wantVal, wantOk, err := serial.Get([]byte(probe))
+				if err != nil {
+					t.Fatal(err)
+				}
+				val, ok, err := sharded.Get([]byte(probe))
+				if err != nil || ok != wantOk || val != wantVal {
+					t.Fatalf("shard size %d: expected %q -> %d %t, got %d %t %v",
+						shardSize, probe, wantVal, wantOk, val, ok, err)
+				}
+			}
+		}
+
+		// full and bounded iteration
+		for _, bounds := range [][2][]byte{
+			{nil, nil},
+			{[]byte("b"), []byte("m")},
+			{[]byte("mon"), nil},
+			{nil, []byte("c")},
+			{[]byte("zzz"), nil},
+		} {
+			sitr, serr := serial.Iterator(bounds[0], bounds[1])
+			want := collectIterator(t, sitr, serr)
+			itr, err := sharded.Iterator(bounds[0], bounds[1])
+			got := collectIterator(t, itr, err)
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("shard size %d: iterator %q-%q mismatch, expected %d keys got %d",
+					shardSize, bounds[0], bounds[1], len(want), len(got))
+			}
+		}
+
+		// seeks
+		sitr, err := serial.Iterator([]byte("b"), []byte("t"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		itr, err := sharded.Iterator([]byte("b"), []byte("t"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"c", "ca", "m", "a", "s", "sz", "t", "zz", "d"} {
+			serr := sitr.Seek([]byte(key))
+			err = itr.Seek([]byte(key))
+			if err != serr {
+				t.Fatalf("shard size %d: seek %q expected err %v, got %v",
+					shardSize, key, serr, err)
+			}
+			if err == nil {
+				wantKey, wantVal := sitr.Current()
+				gotKey, gotVal := itr.Current()
+				if !bytes.Equal(wantKey, gotKey) || wantVal != gotVal {
+					t.Errorf("shard size %d: seek %q expected %q %d, got %q %d",
+						shardSize, key, wantKey, wantVal, gotKey, gotVal)
+				}
+			}
+		}
+	}
+}
+
+func TestShardedDuplicateKeys(t *testing.T) {
+	keys := []string{"a", "b", "b", "b", "c"}
+	vals := []uint64{1, 2, 3, 4, 5}
+	sharded, err := LoadSharded(buildSharded(t, &ShardedBuilderOpts{ShardSize: 2}, keys, vals))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	// equal keys are never split across shards
+	if sharded.NumShards() != 2 {
+		t.Errorf("expected 2 shards, got %d", sharded.NumShards())
+	}
+	itr, err := sharded.Iterator(nil, nil)
+	got := collectIterator(t, itr, err)
+	if len(got) != 3 {
+		t.Errorf("expected 3 distinct keys, got %v", got)
+	}
+}
+
+func TestShardedEmpty(t *testing.T) {
+	sharded, err := LoadSharded(buildSharded(t, nil, nil, nil))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	if sharded.Len() != 0 || sharded.NumShards() != 0 {
+		t.Errorf("expected empty, got %d keys in %d shards", sharded.Len(), sharded.NumShards())
+	}
+	_, ok, err := sharded.Get([]byte("a"))
+	if err != nil || ok {
+		t.Errorf("expected not found, got %t %v", ok, err)
+	}
+	_, err = sharded.Iterator(nil, nil)
+	if err != ErrIteratorDone {
+		t.Errorf("expected ErrIteratorDone, got %v", err)
+	}
+}
+
+func TestShardedErrors(t *testing.T) {
+	b, err := NewShardedBuilder(ioutil.Discard, &ShardedBuilderOpts{ShardSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Insert([]byte("b"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Insert([]byte("a"), 1)
+	if err != ErrOutOfOrder {
+		t.Errorf("expected ErrOutOfOrder, got %v", err)
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewShardedBuilder(ioutil.Discard, &ShardedBuilderOpts{
+		BuilderOpts: &BuilderOpts{Encoder: 629},
+	})
+	if err == nil {
+		t.Errorf("expected error for invalid encoder, got nil")
+	}
+
+	// containers whose fsts overlap are not sharded fsts
+	var buf bytes.Buffer
+	c, err := NewContainerWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buildContainer(t, c, map[string]map[string]uint64{
+		"a": {"cat": 1, "dog": 2},
+		"b": {"cow": 3},
+	}, []string{"a", "b"})
+	err = c.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadSharded(buf.Bytes())
+	if err == nil {
+		t.Errorf("expected error loading overlapping shards, got nil")
+	}
+}
+
+// TestShardedOpenMetadata also uses v3 shards, which have no metadata
+// section, the metadata is stored in the container.
+func TestShardedOpenMetadata(t *testing.T) {
+	for _, ver := range []int{versionV2, versionV3} {
+		t.Run(fmt.Sprintf("v%d", ver), func(t *testing.T) {
+			testShardedOpenMetadata(t, ver)
+		})
+	}
+}
+
+func testShardedOpenMetadata(t *testing.T, ver int) {
+	f, err := ioutil.TempFile("", "vellum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = os.Remove(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	meta := map[string][]byte{"creator": []byte("test")}
+	b, err := NewShardedBuilder(f, &ShardedBuilderOpts{
+		BuilderOpts: &BuilderOpts{
+			Encoder:           ver,
+			RegistryTableSize: 10000,
+			RegistryMRUSize:   2,
+			Metadata:          meta,
+		},
+		ShardSize: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(smallSample))
+	for k := range smallSample {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		err = b.Insert([]byte(k), smallSample[k])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sharded, err := OpenSharded(f.Name())
+	if err != nil {
+		t.Fatalf("error opening: %v", err)
+	}
+	defer func() {
+		err = sharded.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if !reflect.DeepEqual(sharded.Metadata(), meta) {
+		t.Errorf("expected metadata %v, got %v", meta, sharded.Metadata())
+	}
+	for _, k := range keys {
+		val, ok, err := sharded.Get([]byte(k))
+		if err != nil || !ok || val != smallSample[k] {
+			t.Errorf("expected %s -> %d, got %d %t %v", k, smallSample[k], val, ok, err)
+		}
+	}
+}
+
+func BenchmarkShardedBuilder(b *testing.B) {
+	keys := denseTestKeys(200000, 8, 26)
+	vals := randomValues(keys)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		builder, err := NewShardedBuilder(ioutil.Discard, &ShardedBuilderOpts{
+			ShardSize: 20000,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		for j := range keys {
+			err = builder.Insert([]byte(keys[j]), vals[j])
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		err = builder.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSerialBuilder(b *testing.B) {
+	keys := denseTestKeys(200000, 8, 26)
+	vals := randomValues(keys)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		builder, err := New(ioutil.Discard, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for j := range keys {
+			err = builder.Insert([]byte(keys[j]), vals[j])
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		err = builder.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"fmt"
+)
+
+// Split divides the keys of the FST into (at most) n ranges of
+// consecutive keys, with as equal a number of keys in each as possible.
+// Each range is returned as its startKeyInclusive and endKeyExclusive,
+// suitable for passing to Iterator, the start of the first and the end of
+// the last are nil.  Fewer than n ranges are returned if the FST has fewer
+// than n keys.  Split uses the counts of AnnotateCounts, which are computed
+// if they have not been already, the keys themselves are not visited.
+func (f *FST) Split(n int) ([][2][]byte, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid number of ranges %d", n)
+	}
+	err := f.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer f.mu.RUnlock()
+
+	if n > f.len {
+		n = f.len
+	}
+	if n <= 1 {
+		return [][2][]byte{{nil, nil}}, nil
+	}
+	counts, err := f.annotateCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([][2][]byte, n)
+	for i := 1; i < n; i++ {
+		boundary, err := f.selectKey(counts, uint64(i*f.len/n), nil)
+		if err != nil {
+			return nil, err
+		}
+		rv[i-1][1] = boundary
+		rv[i][0] = boundary
+	}
+	return rv, nil
+}
@@ -0,0 +1,89 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	fst, vals, cleanup := openTestFST(t)
+	defer cleanup()
+
+	for _, n := range []int{1, 2, 3, 7, 1000, 2000} {
+		ranges, err := fst.Split(n)
+		if err != nil {
+			t.Fatalf("%d: error splitting: %v", n, err)
+		}
+		expected := n
+		if expected > len(thousandTestWords) {
+			expected = len(thousandTestWords)
+		}
+		if len(ranges) != expected {
+			t.Fatalf("%d: expected %d ranges, got %d", n, expected, len(ranges))
+		}
+		if ranges[0][0] != nil || ranges[len(ranges)-1][1] != nil {
+			t.Errorf("%d: expected open first and last ranges", n)
+		}
+
+		// iterating the ranges visits every key once, in order
+		var i int
+		for _, r := range ranges {
+			var rangeKeys int
+			itr, err := fst.Iterator(r[0], r[1])
+			for err == nil {
+				key, val := itr.Current()
+				if string(key) != thousandTestWords[i] || val != vals[i] {
+					t.Fatalf("%d: expected %q %d, got %q %d", n,
+						thousandTestWords[i], vals[i], key, val)
+				}
+				i++
+				rangeKeys++
+				err = itr.Next()
+			}
+			if err != ErrIteratorDone {
+				t.Fatalf("%d: error iterating: %v", n, err)
+			}
+			min := len(thousandTestWords) / expected
+			if rangeKeys < min || rangeKeys > min+1 {
+				t.Errorf("%d: expected %d or %d keys in range, got %d",
+					n, min, min+1, rangeKeys)
+			}
+		}
+		if i != len(thousandTestWords) {
+			t.Errorf("%d: expected %d keys, got %d", n, len(thousandTestWords), i)
+		}
+	}
+
+	_, err := fst.Split(0)
+	if err == nil {
+		t.Errorf("expected error splitting into 0 ranges")
+	}
+}
+
+func TestSplitEmpty(t *testing.T) {
+	fst, err := Load(buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}, nil, nil))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	ranges, err := fst.Split(4)
+	if err != nil || len(ranges) != 1 || ranges[0][0] != nil || ranges[0][1] != nil {
+		t.Errorf("expected a single open range, got %q %v", ranges, err)
+	}
+}
@@ -0,0 +1,168 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"github.com/willf/bitset"
+)
+
+// FSTStats describes the structure of an FST, see FST.Stats().
+type FSTStats struct {
+	Version int
+	Keys    int
+
+	// States is the number of distinct states written, the final state
+	// with no transitions and no output is implicit and not counted.
+	States      int
+	FinalStates int
+	Transitions int
+
+	// SingleTransStates and MultiTransStates are the number of states
+	// using the compact one transition encoding, and the general encoding.
+	SingleTransStates int
+	MultiTransStates  int
+
+	// FanOut is the number of states with each number of transitions.
+	FanOut map[int]int
+
+	// Depths is the number of states at each depth, the length of the
+	// shortest path to them from the root.
+	Depths map[int]int
+
+	// KeyLengths is the number of keys of each length, that is the number
+	// of keys ending at each depth.
+	KeyLengths map[int]int
+	AvgKeyLen  float64
+	MaxKeyLen  int
+
+	Bytes FSTByteStats
+}
+
+// FSTByteStats is the number of bytes in each section of an FST.
+type FSTByteStats struct {
+	Total    int
+	Header   int
+	Metadata int
+	States   int
+	Footer   int
+
+	// SingleTransStates and MultiTransStates are the number of bytes of
+	// states using each encoding, the rest of the states section (if any)
+	// is unreachable.
+	SingleTransStates int
+	MultiTransStates  int
+}
+
+// Stats visits every state and every key of the FST, and returns
+// statistics describing its structure.  The cost is proportional to the
+// size of the FST plus the total length of the keys.
+func (f *FST) Stats() (*FSTStats, error) {
+	rv, err := f.stateStats()
+	if err != nil {
+		return nil, err
+	}
+
+	// the iterator does its own locking
+	var totalKeyLen int
+	itr, err := f.Iterator(nil, nil)
+	for err == nil {
+		key, _ := itr.Current()
+		rv.KeyLengths[len(key)]++
+		totalKeyLen += len(key)
+		if len(key) > rv.MaxKeyLen {
+			rv.MaxKeyLen = len(key)
+		}
+		err = itr.Next()
+	}
+	if err != ErrIteratorDone {
+		return nil, err
+	}
+	if f.len > 0 {
+		rv.AvgKeyLen = float64(totalKeyLen) / float64(f.len)
+	}
+
+	return rv, nil
+}
+
+// stateStats computes the statistics which describe the states.
+func (f *FST) stateStats() (*FSTStats, error) {
+	err := f.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer f.mu.RUnlock()
+
+	end := f.decoder.getFooterOffset()
+	rv := &FSTStats{
+		Version:    f.ver,
+		Keys:       f.len,
+		FanOut:     map[int]int{},
+		Depths:     map[int]int{},
+		KeyLengths: map[int]int{},
+		Bytes: FSTByteStats{
+			Total:    len(f.data),
+			Header:   headerSize,
+			Metadata: f.dataStart - headerSize,
+			States:   end - f.dataStart,
+			Footer:   len(f.data) - end,
+		},
+	}
+
+	// visit the states breadth first, so that each is first reached by
+	// one of its shortest paths
+	type queued struct {
+		addr  int
+		depth int
+	}
+	set := bitset.New(uint(len(f.data)))
+	queue := []queued{{addr: f.decoder.getRoot()}}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if next.addr == emptyAddr || next.addr == noneAddr ||
+			set.Test(uint(next.addr)) {
+			continue
+		}
+		set.Set(uint(next.addr))
+		state, err := f.decoder.stateAt(next.addr, nil)
+		if err != nil {
+			return nil, err
+		}
+		rv.States++
+		rv.Depths[next.depth]++
+		if state.Final() {
+			rv.FinalStates++
+		}
+		numTrans := state.NumTransitions()
+		rv.Transitions += numTrans
+		rv.FanOut[numTrans]++
+		if sv1, ok := state.(*fstStateV1); ok {
+			size := sv1.top - sv1.bottom + 1
+			if sv1.isEncodedSingle() {
+				rv.SingleTransStates++
+				rv.Bytes.SingleTransStates += size
+			} else {
+				rv.MultiTransStates++
+				rv.Bytes.MultiTransStates += size
+			}
+		}
+		for i := 0; i < numTrans; i++ {
+			_, dest, _ := state.TransitionFor(state.TransitionAt(i))
+			queue = append(queue, queued{addr: dest, depth: next.depth + 1})
+		}
+	}
+
+	return rv, nil
+}
@@ -0,0 +1,154 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	opts := &BuilderOpts{
+		Encoder:           versionV2,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+		Metadata:          map[string][]byte{"k": []byte("v")},
+	}
+	data := buildTestFST(t, opts, []string{"a", "ab", "b", "cd"}, []uint64{1, 2, 3, 4})
+	fst, err := Load(data)
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	stats, err := fst.Stats()
+	if err != nil {
+		t.Fatalf("error computing stats: %v", err)
+	}
+
+	// the root has transitions a, b and c, the state after a is final
+	// with transition b, the state after c has the single transition d
+	bytes := stats.Bytes
+	stats.Bytes = FSTByteStats{}
+	expected := &FSTStats{
+		Version:           versionV2,
+		Keys:              4,
+		States:            3,
+		FinalStates:       1,
+		Transitions:       5,
+		SingleTransStates: 1,
+		MultiTransStates:  2,
+		FanOut:            map[int]int{1: 2, 3: 1},
+		Depths:            map[int]int{0: 1, 1: 2},
+		KeyLengths:        map[int]int{1: 2, 2: 2},
+		AvgKeyLen:         1.5,
+		MaxKeyLen:         2,
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+
+	if bytes.Total != len(data) {
+		t.Errorf("expected %d total bytes, got %d", len(data), bytes.Total)
+	}
+	if bytes.Header != headerSize || bytes.Footer != footerSizeV2 {
+		t.Errorf("expected header %d and footer %d bytes, got %d %d",
+			headerSize, footerSizeV2, bytes.Header, bytes.Footer)
+	}
+	if bytes.Metadata != len(encodeMetadata(opts.Metadata))+8 {
+		t.Errorf("unexpected metadata bytes %d", bytes.Metadata)
+	}
+	if bytes.Header+bytes.Metadata+bytes.States+bytes.Footer != bytes.Total {
+		t.Errorf("sections do not add up to total %+v", bytes)
+	}
+	if bytes.SingleTransStates+bytes.MultiTransStates > bytes.States {
+		t.Errorf("state encodings larger than states section %+v", bytes)
+	}
+}
+
+func TestStatsVersions(t *testing.T) {
+	vals := randomValues(thousandTestWords)
+	var totalKeyLen int
+	for _, word := range thousandTestWords {
+		totalKeyLen += len(word)
+	}
+	for _, ver := range []int{versionV1, versionV2, versionV3, versionV4} {
+		fst, err := Load(buildTestFST(t, &BuilderOpts{
+			Encoder:           ver,
+			RegistryTableSize: 10000,
+			RegistryMRUSize:   2,
+		}, thousandTestWords, vals))
+		if err != nil {
+			t.Fatalf("version %d: error loading: %v", ver, err)
+		}
+		stats, err := fst.Stats()
+		if err != nil {
+			t.Fatalf("version %d: error computing stats: %v", ver, err)
+		}
+
+		if stats.Keys != len(thousandTestWords) {
+			t.Errorf("version %d: expected %d keys, got %d",
+				ver, len(thousandTestWords), stats.Keys)
+		}
+		if stats.SingleTransStates+stats.MultiTransStates != stats.States {
+			t.Errorf("version %d: encodings do not add up to states", ver)
+		}
+		var states, transitions, keys int
+		for n, count := range stats.FanOut {
+			states += count
+			transitions += n * count
+		}
+		for _, count := range stats.KeyLengths {
+			keys += count
+		}
+		if states != stats.States || transitions != stats.Transitions {
+			t.Errorf("version %d: fan-out %d/%d, expected %d/%d", ver,
+				states, transitions, stats.States, stats.Transitions)
+		}
+		states = 0
+		for _, count := range stats.Depths {
+			states += count
+		}
+		if states != stats.States {
+			t.Errorf("version %d: depths count %d states, expected %d",
+				ver, states, stats.States)
+		}
+		if keys != stats.Keys {
+			t.Errorf("version %d: key lengths count %d keys, expected %d",
+				ver, keys, stats.Keys)
+		}
+		avg := float64(totalKeyLen) / float64(len(thousandTestWords))
+		if stats.AvgKeyLen != avg {
+			t.Errorf("version %d: expected average key length %f, got %f",
+				ver, avg, stats.AvgKeyLen)
+		}
+	}
+}
+
+func TestStatsEmpty(t *testing.T) {
+	fst, err := Load(buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}, nil, nil))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	stats, err := fst.Stats()
+	if err != nil {
+		t.Fatalf("error computing stats: %v", err)
+	}
+	if stats.Keys != 0 || stats.Transitions != 0 || stats.AvgKeyLen != 0 {
+		t.Errorf("expected no keys or transitions, got %+v", stats)
+	}
+}
@@ -0,0 +1,81 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"sync"
+)
+
+// Swapper publishes the current version of an FST which is periodically
+// replaced, for example a dictionary rebuilt in the background.  Queries
+// acquire the current FST, and a replacement may be swapped in at any time,
+// the previous FST is closed and its data released once the last query
+// using it releases it.
+type Swapper struct {
+	mu   sync.RWMutex
+	curr *FST
+}
+
+// NewSwapper returns a Swapper publishing the provided FST, which it takes
+// ownership of, it is closed when replaced or when the Swapper is closed.
+func NewSwapper(fst *FST) *Swapper {
+	return &Swapper{curr: fst}
+}
+
+// Acquire returns the current FST, with a reference acquired which the
+// caller MUST release with FST.Release() when done with it.  ErrClosed is
+// returned if the Swapper has been closed.
+func (s *Swapper) Acquire() (*FST, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.curr == nil {
+		return nil, ErrClosed
+	}
+	err := s.curr.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	return s.curr, nil
+}
+
+// Swap publishes the provided FST, taking ownership of it, and closes the
+// FST it replaces.  Queries which acquired the previous FST continue to use
+// it until they release it, all those started afterwards use the new one.
+// If the Swapper has been closed ErrClosed is returned, and the provided
+// FST remains owned by the caller.
+func (s *Swapper) Swap(fst *FST) error {
+	s.mu.Lock()
+	if s.curr == nil {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	prev := s.curr
+	s.curr = fst
+	s.mu.Unlock()
+	return prev.Close()
+}
+
+// Close closes the current FST, after which Acquire and Swap return
+// ErrClosed.
+func (s *Swapper) Close() error {
+	s.mu.Lock()
+	prev := s.curr
+	s.curr = nil
+	s.mu.Unlock()
+	if prev == nil {
+		return nil
+	}
+	return prev.Close()
+}
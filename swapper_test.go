@@ -0,0 +1,139 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSwapper(t *testing.T) {
+	first, firstVals, cleanupFirst := openTestFST(t)
+	defer cleanupFirst()
+	second, secondVals, cleanupSecond := openTestFST(t)
+	defer cleanupSecond()
+
+	s := NewSwapper(first)
+	held, err := s.Acquire()
+	if err != nil || held != first {
+		t.Fatalf("expected first fst, got %p %v", held, err)
+	}
+
+	err = s.Swap(second)
+	if err != nil {
+		t.Fatalf("error swapping: %v", err)
+	}
+	curr, err := s.Acquire()
+	if err != nil || curr != second {
+		t.Fatalf("expected second fst, got %p %v", curr, err)
+	}
+
+	// the first remains usable until released
+	key := []byte(thousandTestWords[0])
+	val, _, err := held.Get(key)
+	if err != nil || val != firstVals[0] {
+		t.Errorf("expected %d, got %d %v", firstVals[0], val, err)
+	}
+	err = held.Release()
+	if err != nil {
+		t.Fatalf("error releasing: %v", err)
+	}
+	_, _, err = held.Get(key)
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed after release, got %v", err)
+	}
+
+	err = s.Close()
+	if err != nil {
+		t.Fatalf("error closing: %v", err)
+	}
+	_, err = s.Acquire()
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed after close, got %v", err)
+	}
+	err = s.Swap(first)
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed swapping after close, got %v", err)
+	}
+	val, _, err = curr.Get(key)
+	if err != nil || val != secondVals[0] {
+		t.Errorf("expected %d, got %d %v", secondVals[0], val, err)
+	}
+	err = curr.Release()
+	if err != nil {
+		t.Fatalf("error releasing: %v", err)
+	}
+}
+
+func TestSwapperConcurrent(t *testing.T) {
+	fst, _, cleanup := openTestFST(t)
+	defer cleanup()
+	s := NewSwapper(fst)
+
+	// queries iterate every key of whichever FST is current, while the
+	// FST is repeatedly replaced underneath them
+	var done int32
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&done) == 0 {
+				curr, err := s.Acquire()
+				if err != nil {
+					t.Errorf("error acquiring: %v", err)
+					return
+				}
+				var n int
+				itr, err := curr.Iterator(nil, nil)
+				for err == nil {
+					itr.Current()
+					n++
+					err = itr.Next()
+				}
+				if err != ErrIteratorDone || n != len(thousandTestWords) {
+					t.Errorf("expected %d keys, got %d %v",
+						len(thousandTestWords), n, err)
+				}
+				err = curr.Release()
+				if err != nil {
+					t.Errorf("error releasing: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	var cleanups []func()
+	for i := 0; i < 20; i++ {
+		next, _, cleanupNext := openTestFST(t)
+		cleanups = append(cleanups, cleanupNext)
+		err := s.Swap(next)
+		if err != nil {
+			t.Fatalf("error swapping: %v", err)
+		}
+	}
+	atomic.StoreInt32(&done, 1)
+	wg.Wait()
+
+	err := s.Close()
+	if err != nil {
+		t.Fatalf("error closing: %v", err)
+	}
+	for _, cleanupNext := range cleanups {
+		cleanupNext()
+	}
+}
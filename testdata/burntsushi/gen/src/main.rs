@@ -0,0 +1,27 @@
+// Builds the golden file for a corpus of sorted `key,value` lines with the
+// Rust fst crate, usage: vellum-burntsushi-gen <corpus.csv> <golden.fst>
+
+use std::env;
+use std::error::Error;
+use std::fs::File;
+use std::io::{BufRead, BufReader, BufWriter};
+
+use fst::MapBuilder;
+
+fn main() -> Result<(), Box<dyn Error>> {
+    let args: Vec<String> = env::args().collect();
+    if args.len() != 3 {
+        return Err("usage: vellum-burntsushi-gen <corpus.csv> <golden.fst>".into());
+    }
+    let corpus = BufReader::new(File::open(&args[1])?);
+    let mut builder = MapBuilder::new(BufWriter::new(File::create(&args[2])?))?;
+    for line in corpus.lines() {
+        let line = line?;
+        let i = line
+            .rfind(',')
+            .ok_or_else(|| format!("invalid corpus line {:?}", line))?;
+        builder.insert(&line[..i], line[i + 1..].parse::<u64>()?)?;
+    }
+    builder.finish()?;
+    Ok(())
+}
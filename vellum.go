@@ -57,6 +57,28 @@ type BuilderOpts struct {
 	Encoder           int
 	RegistryTableSize int
 	RegistryMRUSize   int
+
+	// RegistryExact replaces the fixed size registry (RegistryTableSize
+	// and RegistryMRUSize are ignored) with one which remembers every
+	// state, guaranteeing a minimal FST.  The memory used while building
+	// grows with the number of states in the FST.
+	RegistryExact bool
+
+	// Metadata is optional user metadata (such as the creator version,
+	// build time or key schema) stored in the FST, it is available at
+	// runtime through FST.Metadata().  An empty map stores no metadata.
+	Metadata map[string][]byte
+
+	// DenseThreshold is the number of transitions at or above which a
+	// state also stores a bitmap for direct lookup of its transitions.
+	// It is only used by the v4 encoding, zero means the default (16).
+	DenseThreshold int
+
+	// Progress is an optional callback, invoked by Insert with the
+	// current Builder statistics every ProgressInterval keys (zero means
+	// the default, 100000).
+	Progress         func(BuilderStats)
+	ProgressInterval int
 }
 
 // New returns a new Builder which will stream out the
@@ -65,25 +87,77 @@ func New(w io.Writer, opts *BuilderOpts) (*Builder, error) {
 	return newBuilder(w, opts)
 }
 
+// LoadOpts is a structure to let advanced users customize how an FST
+// is loaded.
+type LoadOpts struct {
+	// SafeDecode validates every address and length read from the FST
+	// data against the bounds of the data, returning a *CorruptError
+	// instead of panicking.  This should be used when loading FSTs from
+	// sources which are not trusted, it has a small runtime cost.
+	SafeDecode bool
+}
+
+var defaultLoadOpts = &LoadOpts{}
+
 // Open loads the FST stored in the provided path
 func Open(path string) (*FST, error) {
-	return open(path)
+	return open(path, nil)
+}
+
+// OpenWithOpts loads the FST stored in the provided path, using the
+// provided LoadOpts.
+func OpenWithOpts(path string, opts *LoadOpts) (*FST, error) {
+	return open(path, opts)
 }
 
 // Load will return the FST represented by the provided byte slice.
 func Load(data []byte) (*FST, error) {
-	return new(data, nil)
+	return new(data, nil, nil)
+}
+
+// LoadWithOpts will return the FST represented by the provided byte slice,
+// using the provided LoadOpts.
+func LoadWithOpts(data []byte, opts *LoadOpts) (*FST, error) {
+	return new(data, nil, opts)
 }
 
 // Merge will iterate through the provided Iterators, merge duplicate keys
 // with the provided MergeFunc, and build a new FST to the provided Writer.
 func Merge(w io.Writer, opts *BuilderOpts, itrs []Iterator, f MergeFunc) error {
-	builder, err := New(w, opts)
-	if err != nil {
+	return MergeKeyed(w, opts, itrs, keyedMergeFunc(f))
+}
+
+// MergeWithDelete will iterate through the provided Iterators, choose the
+// value of each key, or delete it, with the provided MergeDeleteFunc, and
+// build a new FST to the provided Writer.
+func MergeWithDelete(w io.Writer, opts *BuilderOpts, itrs []Iterator,
+	f MergeDeleteFunc) error {
+	return MergeKeyed(w, opts, itrs, keyedMergeDeleteFunc(f))
+}
+
+// MergeKeyed will iterate through the provided Iterators, choose the value
+// of each key, or delete it, with the provided KeyedMergeFunc, and build a
+// new FST to the provided Writer.
+func MergeKeyed(w io.Writer, opts *BuilderOpts, itrs []Iterator,
+	f KeyedMergeFunc) error {
+	itr, err := NewKeyedMergeIterator(itrs, f)
+	return buildMerged(w, opts, itr, err)
+}
+
+// buildMerged builds a new FST to the provided Writer from the keys of the
+// MergeIterator, err being the result of creating it, and closes it.
+func buildMerged(w io.Writer, opts *BuilderOpts, itr *MergeIterator, err error) error {
+	if err != nil && err != ErrIteratorDone {
+		_ = itr.Close()
 		return err
 	}
 
-	itr, err := NewMergeIterator(itrs, f)
+	builder, berr := New(w, opts)
+	if berr != nil {
+		_ = itr.Close()
+		return berr
+	}
+
 	for err == nil {
 		k, v := itr.Current()
 		err = builder.Insert(k, v)
@@ -109,3 +183,39 @@ func Merge(w io.Writer, opts *BuilderOpts, itrs []Iterator, f MergeFunc) error {
 
 	return nil
 }
+
+// Transcode re-encodes the provided FST, by iterating through it and
+// building a new FST to the provided Writer with the provided BuilderOpts,
+// typically to select a different encoding version.  The metadata of the
+// FST is preserved, unless opts.Metadata is set (an empty map removes it).
+func Transcode(fst *FST, w io.Writer, opts *BuilderOpts) error {
+	if opts == nil {
+		opts = defaultBuilderOpts
+	}
+	if opts.Metadata == nil && fst.Metadata() != nil {
+		withMeta := *opts
+		withMeta.Metadata = fst.Metadata()
+		opts = &withMeta
+	}
+
+	builder, err := New(w, opts)
+	if err != nil {
+		return err
+	}
+
+	itr, err := fst.Iterator(nil, nil)
+	for err == nil {
+		k, v := itr.Current()
+		err = builder.Insert(k, v)
+		if err != nil {
+			return err
+		}
+		err = itr.Next()
+	}
+
+	if err != nil && err != ErrIteratorDone {
+		return err
+	}
+
+	return builder.Close()
+}
@@ -17,6 +17,7 @@
 package vellum
 
 import (
+	"io"
 	"os"
 
 	mmap "github.com/blevesearch/mmap-go"
@@ -42,19 +43,34 @@ func (m *mmapWrapper) Close() (err error) {
 	return
 }
 
-func open(path string) (*FST, error) {
-	f, err := os.Open(path)
+func open(path string, opts *LoadOpts) (*FST, error) {
+	data, closer, err := openData(path)
 	if err != nil {
 		return nil, err
 	}
+	rv, err := new(data, closer, opts)
+	if err != nil {
+		_ = closer.Close()
+		return nil, err
+	}
+	return rv, nil
+}
+
+// openData mmaps the file at the provided path, returning the mapped bytes
+// along with the io.Closer responsible for unmapping them.
+func openData(path string) ([]byte, io.Closer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
 	mm, err := mmap.Map(f, mmap.RDONLY, 0)
 	if err != nil {
 		// mmap failed, try to close the file
 		_ = f.Close()
-		return nil, err
+		return nil, nil, err
 	}
-	return new(mm, &mmapWrapper{
+	return mm, &mmapWrapper{
 		f:  f,
 		mm: mm,
-	})
+	}, nil
 }
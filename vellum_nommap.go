@@ -16,12 +16,25 @@
 
 package vellum
 
-import "io/ioutil"
+import (
+	"io"
+	"io/ioutil"
+)
 
-func open(path string) (*FST, error) {
-	data, err := ioutil.ReadFile(string)
+func open(path string, opts *LoadOpts) (*FST, error) {
+	data, _, err := openData(path)
 	if err != nil {
 		return nil, err
 	}
-	return new(data, nil)
+	return new(data, nil, opts)
+}
+
+// openData reads the entire file at the provided path into memory, there
+// is no io.Closer as nothing needs to be released.
+func openData(path string) ([]byte, io.Closer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, nil, nil
 }
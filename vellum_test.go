@@ -19,6 +19,7 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -678,3 +679,104 @@ func TestMaxWithSubstring(t *testing.T) {
 		t.Fatalf("expected max key 99, got %s", string(maxk))
 	}
 }
+
+func TestTranscode(t *testing.T) {
+	keys := append([]string{""}, thousandTestWords...)
+	sort.Strings(keys)
+	vals := randomValues(keys)
+	meta := map[string][]byte{"creator": []byte("test")}
+	src := buildTestFST(t, &BuilderOpts{
+		Encoder:           versionV1,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+		Metadata:          meta,
+	}, keys, vals)
+	fst, err := Load(src)
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+
+	for _, ver := range []int{versionV1, versionV2, versionV4} {
+		var buf bytes.Buffer
+		err = Transcode(fst, &buf, &BuilderOpts{
+			Encoder:           ver,
+			RegistryTableSize: 10000,
+			RegistryMRUSize:   2,
+		})
+		if err != nil {
+			t.Fatalf("version %d: error transcoding: %v", ver, err)
+		}
+		if ver == versionV1 && !bytes.Equal(buf.Bytes(), src) {
+			t.Errorf("version %d: expected identical bytes", ver)
+		}
+		dst, err := Load(buf.Bytes())
+		if err != nil {
+			t.Fatalf("version %d: error loading: %v", ver, err)
+		}
+		if dst.Version() != ver {
+			t.Errorf("expected version %d, got %d", ver, dst.Version())
+		}
+		if !reflect.DeepEqual(dst.Metadata(), meta) {
+			t.Errorf("version %d: expected metadata %v, got %v", ver, meta, dst.Metadata())
+		}
+		if dst.Len() != len(keys) {
+			t.Errorf("version %d: expected len %d, got %d", ver, len(keys), dst.Len())
+		}
+		for i, key := range keys {
+			val, ok, err := dst.Get([]byte(key))
+			if err != nil || !ok || val != vals[i] {
+				t.Errorf("version %d: expected %q -> %d, got %d %t %v",
+					ver, key, vals[i], val, ok, err)
+			}
+		}
+	}
+
+	// the BurntSushi format cannot store metadata
+	err = Transcode(fst, ioutil.Discard, &BuilderOpts{
+		Encoder:           versionV3,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	})
+	if err == nil {
+		t.Errorf("expected error transcoding metadata to version 3, got nil")
+	}
+
+	// removing the metadata allows it
+	var buf bytes.Buffer
+	err = Transcode(fst, &buf, &BuilderOpts{
+		Encoder:           versionV3,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+		Metadata:          map[string][]byte{},
+	})
+	if err != nil {
+		t.Fatalf("error transcoding to version 3: %v", err)
+	}
+	dst, err := Load(buf.Bytes())
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	if dst.Metadata() != nil || dst.Len() != len(keys) {
+		t.Errorf("expected %d keys and no metadata, got %d %v",
+			len(keys), dst.Len(), dst.Metadata())
+	}
+}
+
+func TestTranscodeEmpty(t *testing.T) {
+	fst, err := Load(buildTestFST(t, nil, nil, nil))
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	var buf bytes.Buffer
+	err = Transcode(fst, &buf, nil)
+	if err != nil {
+		t.Fatalf("error transcoding: %v", err)
+	}
+	dst, err := Load(buf.Bytes())
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	if dst.Len() != 0 {
+		t.Errorf("expected len 0, got %d", dst.Len())
+	}
+}
@@ -0,0 +1,176 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/willf/bitset"
+)
+
+// HasChecksum returns true if the encoding version used by this FST
+// instance stores a checksum of the data.
+func (f *FST) HasChecksum() bool {
+	if f.rlock() != nil {
+		return false
+	}
+	defer f.mu.RUnlock()
+	_, ok := f.decoder.(checksumDecoder)
+	return ok
+}
+
+// Verify checks the integrity of this FST.  If the encoding version stores
+// a checksum, it is validated first.  Then every state reachable from the
+// root is decoded and checked, and finally the number of keys reachable
+// is compared with Len().  Any corruption detected is reported as a
+// *CorruptError.
+func (f *FST) Verify() error {
+	err := f.rlock()
+	if err != nil {
+		return err
+	}
+	defer f.mu.RUnlock()
+
+	if cd, ok := f.decoder.(checksumDecoder); ok {
+		stored, computed, offset := cd.checksum()
+		if stored != computed {
+			return &CorruptError{
+				Offset: offset,
+				Msg: fmt.Sprintf("checksum mismatch, stored %#x, computed %#x",
+					stored, computed),
+			}
+		}
+	}
+	return f.verifyStates()
+}
+
+func (f *FST) verifyStates() (err error) {
+	// the address being processed, reported if decoding panics
+	addr := f.decoder.getRoot()
+	defer func() {
+		if r := recover(); r != nil {
+			err = &CorruptError{
+				Offset: addr,
+				Msg:    fmt.Sprintf("invalid state: %v", r),
+			}
+		}
+	}()
+
+	end := f.decoder.getFooterOffset()
+
+	// first pass, visit every reachable state checking its encoding
+	var addrs []int
+	set := bitset.New(uint(len(f.data)))
+	stack := addrStack{addr}
+	for len(stack) > 0 {
+		stack, addr = stack.Pop()
+		if addr == emptyAddr || set.Test(uint(addr)) {
+			continue
+		}
+		if addr < f.dataStart || addr >= end {
+			return &CorruptError{
+				Offset: addr,
+				Msg:    fmt.Sprintf("state address outside data %d-%d", f.dataStart, end),
+			}
+		}
+		set.Set(uint(addr))
+		addrs = append(addrs, addr)
+
+		state, err := f.decoder.stateAt(addr, nil)
+		if err != nil {
+			return asCorruptError(addr, err)
+		}
+		bottom := addr
+		if sv1, ok := state.(*fstStateV1); ok {
+			bottom = sv1.bottom
+		}
+		if bottom < f.dataStart {
+			return &CorruptError{
+				Offset: addr,
+				Msg:    fmt.Sprintf("state extends before data start %d", f.dataStart),
+			}
+		}
+		for i := 0; i < state.NumTransitions(); i++ {
+			t := state.TransitionAt(i)
+			if i > 0 && t <= state.TransitionAt(i-1) {
+				return &CorruptError{
+					Offset: addr,
+					Msg:    fmt.Sprintf("transitions out of order at %d", i),
+				}
+			}
+			pos, dest, _ := state.TransitionFor(t)
+			if pos != i {
+				return &CorruptError{
+					Offset: addr,
+					Msg:    fmt.Sprintf("transition %d found at position %d", i, pos),
+				}
+			}
+			// states are always written before the states which point to
+			// them, so any valid transition points to a lower address
+			if dest != emptyAddr &&
+				(dest == noneAddr || dest >= bottom || dest < f.dataStart) {
+				return &CorruptError{
+					Offset: addr,
+					Msg:    fmt.Sprintf("transition %d to invalid address %d", i, dest),
+				}
+			}
+			stack = append(stack, dest)
+		}
+	}
+
+	// second pass, count the keys reachable from each state, lowest
+	// address first so that all destinations have already been counted
+	sort.Ints(addrs)
+	counts := make(map[int]uint64, len(addrs)+1)
+	counts[emptyAddr] = 1
+	for _, addr = range addrs {
+		state, err := f.decoder.stateAt(addr, nil)
+		if err != nil {
+			return asCorruptError(addr, err)
+		}
+		var count uint64
+		if state.Final() {
+			count++
+		}
+		for i := 0; i < state.NumTransitions(); i++ {
+			_, dest, _ := state.TransitionFor(state.TransitionAt(i))
+			count += counts[dest]
+		}
+		counts[addr] = count
+	}
+
+	root := f.decoder.getRoot()
+	if counts[root] != uint64(f.len) {
+		return &CorruptError{
+			Offset: end,
+			Msg: fmt.Sprintf("footer has %d keys, found %d keys",
+				f.len, counts[root]),
+		}
+	}
+
+	return nil
+}
+
+// asCorruptError returns err if it is already a *CorruptError, otherwise
+// it describes err as corruption at the provided offset.
+func asCorruptError(offset int, err error) error {
+	var ce *CorruptError
+	if errors.As(err, &ce) {
+		return err
+	}
+	return corruptError(offset, err.Error())
+}
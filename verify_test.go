@@ -0,0 +1,141 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func buildTestFST(t testing.TB, opts *BuilderOpts, keys []string, vals []uint64) []byte {
+	var buf bytes.Buffer
+	b, err := New(&buf, opts)
+	if err != nil {
+		t.Fatalf("error creating builder: %v", err)
+	}
+	err = insertStrings(b, keys, vals)
+	if err != nil {
+		t.Fatalf("error building: %v", err)
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatalf("error closing: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerify(t *testing.T) {
+	vals := randomValues(thousandTestWords)
+	for _, ver := range []int{versionV1, versionV2} {
+		opts := &BuilderOpts{
+			Encoder:           ver,
+			RegistryTableSize: 10000,
+			RegistryMRUSize:   2,
+			Metadata:          map[string][]byte{"test": []byte("verify")},
+		}
+		for _, keys := range [][]string{thousandTestWords, {}, {""}, {"", "a"}} {
+			data := buildTestFST(t, opts, keys, vals[:len(keys)])
+			fst, err := Load(data)
+			if err != nil {
+				t.Fatalf("error loading: %v", err)
+			}
+			err = fst.Verify()
+			if err != nil {
+				t.Errorf("v%d %d keys: unexpected verify error: %v", ver, len(keys), err)
+			}
+		}
+	}
+}
+
+func TestVerifyCorrupt(t *testing.T) {
+	vals := randomValues(thousandTestWords)
+	data := buildTestFST(t, nil, thousandTestWords, vals)
+
+	tests := []struct {
+		desc    string
+		corrupt func(data []byte)
+	}{
+		{
+			"wrong len",
+			func(data []byte) {
+				footer := data[len(data)-footerSizeV1:]
+				binary.LittleEndian.PutUint64(footer, uint64(len(thousandTestWords)+1))
+			},
+		},
+		{
+			"root past end",
+			func(data []byte) {
+				footer := data[len(data)-footerSizeV1:]
+				binary.LittleEndian.PutUint64(footer[8:], uint64(len(data)))
+			},
+		},
+		{
+			"root in header",
+			func(data []byte) {
+				footer := data[len(data)-footerSizeV1:]
+				binary.LittleEndian.PutUint64(footer[8:], 8)
+			},
+		},
+		{
+			"root none",
+			func(data []byte) {
+				footer := data[len(data)-footerSizeV1:]
+				binary.LittleEndian.PutUint64(footer[8:], noneAddr)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		corrupt := append([]byte(nil), data...)
+		test.corrupt(corrupt)
+		fst, err := Load(corrupt)
+		if err != nil {
+			continue
+		}
+		err = fst.Verify()
+		if _, ok := err.(*CorruptError); !ok {
+			t.Errorf("%s: expected corrupt error, got %v", test.desc, err)
+		}
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	opts := &BuilderOpts{
+		Encoder:           versionV2,
+		RegistryTableSize: 10000,
+		RegistryMRUSize:   2,
+	}
+	data := buildTestFST(t, opts, thousandTestWords, randomValues(thousandTestWords))
+
+	// flip a single bit in every position, checksum must catch all of them
+	for i := 0; i < len(data); i++ {
+		corrupt := append([]byte(nil), data...)
+		corrupt[i] ^= 0x10
+		fst, err := Load(corrupt)
+		if err != nil {
+			continue
+		}
+		err = fst.Verify()
+		cerr, ok := err.(*CorruptError)
+		if !ok {
+			t.Fatalf("flip at %d: expected corrupt error, got %v", i, err)
+		}
+		if cerr.Offset != len(data)-checksumSize {
+			t.Errorf("flip at %d: expected checksum offset %d, got %d", i,
+				len(data)-checksumSize, cerr.Offset)
+		}
+	}
+}
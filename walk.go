@@ -0,0 +1,58 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+// WalkFunc is called by Walk for each key/value pair visited.  The key is
+// only valid until the function returns, if it is needed afterwards a copy
+// must be made.  Returning an error stops the walk.
+type WalkFunc func(key []byte, val uint64) error
+
+// Walk calls the function for each of the key/value pairs between the
+// provided startKeyInclusive and endKeyExclusive which also satisfy the
+// automaton (nil means all of them), in order.  It is equivalent to using
+// Search, but without the locking and interface calls of the iterator
+// methods for each key.  Walk holds a reference to the FST (see Acquire)
+// for its duration, the function may use the FST, and the FST may be
+// closed during the walk.  If the function returns an error, the walk
+// stops and that error is returned.
+func (f *FST) Walk(startKeyInclusive, endKeyExclusive []byte, aut Automaton,
+	fn WalkFunc) (err error) {
+	err = f.Acquire()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr := f.Release(); err == nil {
+			err = rerr
+		}
+	}()
+
+	if aut == nil {
+		aut = alwaysMatchAutomaton
+	}
+	var itr FSTIterator
+	err = itr.reset(f, startKeyInclusive, endKeyExclusive, aut)
+	for err == nil {
+		err = fn(itr.current())
+		if err != nil {
+			return err
+		}
+		err = itr.next(-1)
+	}
+	if err == ErrIteratorDone {
+		return nil
+	}
+	return err
+}
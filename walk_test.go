@@ -0,0 +1,143 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vellum
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/couchbase/vellum/regexp"
+)
+
+func TestWalk(t *testing.T) {
+	fst, _, cleanup := openTestFST(t)
+	defer cleanup()
+
+	re, err := regexp.New("c.*")
+	if err != nil {
+		t.Fatalf("error compiling regexp: %v", err)
+	}
+	tests := []struct {
+		start, end []byte
+		aut        Automaton
+	}{
+		{nil, nil, nil},
+		{[]byte("b"), []byte("d"), nil},
+		{nil, nil, re},
+		{[]byte("ca"), []byte("cb"), re},
+	}
+	for _, test := range tests {
+		var expected []keyVal
+		itr, err := fst.Search(test.aut, test.start, test.end)
+		for err == nil {
+			key, val := itr.Current()
+			expected = append(expected, keyVal{string(key), val})
+			err = itr.Next()
+		}
+		if err != ErrIteratorDone {
+			t.Fatalf("error iterating: %v", err)
+		}
+
+		var got []keyVal
+		err = fst.Walk(test.start, test.end, test.aut, func(key []byte, val uint64) error {
+			got = append(got, keyVal{string(key), val})
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("error walking: %v", err)
+		}
+		if len(got) != len(expected) || len(got) == 0 {
+			t.Fatalf("%q-%q: expected %d keys, got %d",
+				test.start, test.end, len(expected), len(got))
+		}
+		for i := range got {
+			if got[i] != expected[i] {
+				t.Errorf("expected %v, got %v", expected[i], got[i])
+			}
+		}
+	}
+}
+
+func TestWalkStop(t *testing.T) {
+	fst, _, cleanup := openTestFST(t)
+	defer cleanup()
+
+	stop := fmt.Errorf("stop")
+	var n int
+	err := fst.Walk(nil, nil, nil, func([]byte, uint64) error {
+		n++
+		if n == 10 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 10 {
+		t.Errorf("expected walk to stop after 10 keys, got %d %v", n, err)
+	}
+}
+
+func TestWalkClose(t *testing.T) {
+	fst, vals, cleanup := openTestFST(t)
+	defer cleanup()
+
+	// the walk holds a reference, so closing during it is safe
+	var n int
+	err := fst.Walk(nil, nil, nil, func(key []byte, val uint64) error {
+		if val != vals[n] {
+			return fmt.Errorf("expected %d at %d, got %d", vals[n], n, val)
+		}
+		n++
+		if n == 100 {
+			return fst.Close()
+		}
+		return nil
+	})
+	if err != nil || n != len(thousandTestWords) {
+		t.Errorf("expected %d keys, got %d %v", len(thousandTestWords), n, err)
+	}
+	err = fst.Walk(nil, nil, nil, func([]byte, uint64) error {
+		return nil
+	})
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func BenchmarkIterator(b *testing.B) {
+	fst, _, cleanup := openTestFST(b)
+	defer cleanup()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		itr, err := fst.Iterator(nil, nil)
+		for err == nil {
+			key, val = itr.Current()
+			err = itr.Next()
+		}
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	fst, _, cleanup := openTestFST(b)
+	defer cleanup()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = fst.Walk(nil, nil, nil, func(k []byte, v uint64) error {
+			key, val = k, v
+			return nil
+		})
+	}
+}